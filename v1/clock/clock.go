@@ -0,0 +1,403 @@
+// Tideland Go Application Support - Clock
+//
+// Copyright (C) 2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package clock
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//--------------------
+// CLOCK
+//--------------------
+
+// Clock provides the current time, timers, and tickers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+
+	// Until returns the duration until t.
+	Until(t time.Time) time.Duration
+
+	// After waits for the duration to elapse and then sends
+	// the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep pauses the current goroutine for the duration.
+	Sleep(d time.Duration)
+
+	// NewTimer creates a timer sending the current time on
+	// its channel after the duration.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker creates a ticker sending the current time on
+	// its channel with the period of the duration.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event like time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false
+	// if the timer already expired or has been stopped.
+	Stop() bool
+
+	// Reset changes the timer to expire after the duration.
+	// It returns true if the timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker delivers ticks at intervals like time.Ticker.
+type Ticker interface {
+	// C returns the channel the ticks are sent on.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+
+	// Reset stops the ticker and resets its period to the
+	// duration.
+	Reset(d time.Duration)
+}
+
+//--------------------
+// REAL CLOCK
+//--------------------
+
+// realClock uses the functions of the time package.
+type realClock struct{}
+
+// theRealClock is the one real clock.
+var theRealClock = realClock{}
+
+// Real returns the clock based on the time package.
+func Real() Clock {
+	return theRealClock
+}
+
+// Now is specified on the Clock interface.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Since is specified on the Clock interface.
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// Until is specified on the Clock interface.
+func (realClock) Until(t time.Time) time.Duration {
+	return time.Until(t)
+}
+
+// After is specified on the Clock interface.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Sleep is specified on the Clock interface.
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTimer is specified on the Clock interface.
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{time.NewTimer(d)}
+}
+
+// NewTicker is specified on the Clock interface.
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{time.NewTicker(d)}
+}
+
+// realTimer wraps a time.Timer.
+type realTimer struct {
+	timer *time.Timer
+}
+
+// C is specified on the Timer interface.
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// Stop is specified on the Timer interface.
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// Reset is specified on the Timer interface.
+func (t *realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// realTicker wraps a time.Ticker.
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+// C is specified on the Ticker interface.
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+// Stop is specified on the Ticker interface.
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// Reset is specified on the Ticker interface.
+func (t *realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+//--------------------
+// FAKE CLOCK
+//--------------------
+
+// Fake is a clock only changing its time when advanced
+// manually. Timers, tickers, and sleeps waiting for a time
+// are released when the clock reaches it.
+type Fake struct {
+	mux     sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewFake creates a fake clock starting at the passed time.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{
+		now: now,
+	}
+	f.cond = sync.NewCond(&f.mux)
+	return f
+}
+
+// Now is specified on the Clock interface.
+func (f *Fake) Now() time.Time {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.now
+}
+
+// Since is specified on the Clock interface.
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Until is specified on the Clock interface.
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+// After is specified on the Clock interface.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Sleep is specified on the Clock interface.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTimer is specified on the Clock interface.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f.newWaiter()}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker is specified on the Clock interface. Like
+// time.NewTicker it panics with a non-positive duration.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	t := &fakeTicker{f.newWaiter()}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by the duration and fires all
+// timers and tickers which are due in the order of their times.
+func (f *Fake) Advance(d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.advanceLocked(f.now.Add(d))
+}
+
+// Set moves the clock to the passed time. Setting it to the past
+// only changes the current time, nothing fires.
+func (f *Fake) Set(t time.Time) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if t.Before(f.now) {
+		f.now = t
+		return
+	}
+	f.advanceLocked(t)
+}
+
+// Waiters returns the number of active timers, tickers,
+// and sleeps.
+func (f *Fake) Waiters() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil blocks the caller until at least n timers,
+// tickers, or sleeps are active. This way tests can wait
+// for goroutines using the clock before advancing it.
+func (f *Fake) BlockUntil(n int) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// advanceLocked fires the waiters due until the end time.
+func (f *Fake) advanceLocked(end time.Time) {
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool {
+			return f.waiters[i].when.Before(f.waiters[j].when)
+		})
+		if len(f.waiters) == 0 || f.waiters[0].when.After(end) {
+			break
+		}
+		w := f.waiters[0]
+		f.now = w.when
+		w.fire()
+	}
+	f.now = end
+}
+
+// newWaiter creates an inactive waiter.
+func (f *Fake) newWaiter() *waiter {
+	return &waiter{
+		fake: f,
+		c:    make(chan time.Time, 1),
+	}
+}
+
+// add registers a waiter.
+func (f *Fake) add(w *waiter) {
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// remove unregisters a waiter. It returns false if the
+// waiter hasn't been active.
+func (f *Fake) remove(w *waiter) bool {
+	for i, fw := range f.waiters {
+		if fw == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// waiter waits for a time of the fake clock. A period
+// greater than zero lets it fire repeatedly.
+type waiter struct {
+	fake   *Fake
+	c      chan time.Time
+	when   time.Time
+	period time.Duration
+}
+
+// stop deactivates the waiter.
+func (w *waiter) stop() bool {
+	w.fake.mux.Lock()
+	defer w.fake.mux.Unlock()
+	return w.fake.remove(w)
+}
+
+// reset activates the waiter for the time after the duration.
+func (w *waiter) reset(d, period time.Duration) bool {
+	w.fake.mux.Lock()
+	defer w.fake.mux.Unlock()
+	active := w.fake.remove(w)
+	w.when = w.fake.now.Add(d)
+	w.period = period
+	w.fake.add(w)
+	if d <= 0 {
+		w.fake.advanceLocked(w.fake.now)
+	}
+	return active
+}
+
+// fire sends the time without blocking like the time package
+// does. Periodic waiters are scheduled again, others are removed.
+func (w *waiter) fire() {
+	select {
+	case w.c <- w.when:
+	default:
+	}
+	if w.period > 0 {
+		w.when = w.when.Add(w.period)
+		return
+	}
+	w.fake.remove(w)
+}
+
+// fakeTimer is a timer of the fake clock.
+type fakeTimer struct {
+	*waiter
+}
+
+// C is specified on the Timer interface.
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop is specified on the Timer interface.
+func (t *fakeTimer) Stop() bool {
+	return t.stop()
+}
+
+// Reset is specified on the Timer interface.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	return t.reset(d, 0)
+}
+
+// fakeTicker is a ticker of the fake clock.
+type fakeTicker struct {
+	*waiter
+}
+
+// C is specified on the Ticker interface.
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop is specified on the Ticker interface.
+func (t *fakeTicker) Stop() {
+	t.stop()
+}
+
+// Reset is specified on the Ticker interface. Like
+// time.Ticker it panics with a non-positive duration.
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for ticker")
+	}
+	t.reset(d, d)
+}
+
+// EOF
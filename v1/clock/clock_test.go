@@ -0,0 +1,134 @@
+// Tideland Go Application Support - Clock - Unit Tests
+//
+// Copyright (C) 2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package clock_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tideland/goas/v1/clock"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+var start = time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// Test the real clock.
+func TestReal(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	c := clock.Real()
+	now := c.Now()
+
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(timer.Stop(), "timer already expired")
+	assert.True(c.Since(now) >= time.Millisecond, "time elapsed")
+
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	<-ticker.C()
+	ticker.Stop()
+}
+
+// Test the time of the fake clock.
+func TestFakeTime(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	c := clock.NewFake(start)
+
+	assert.Equal(c.Now(), start)
+	c.Advance(time.Hour)
+	assert.Equal(c.Now(), start.Add(time.Hour))
+	assert.Equal(c.Since(start), time.Hour)
+	assert.Equal(c.Until(start.Add(2*time.Hour)), time.Hour)
+	c.Set(start)
+	assert.Equal(c.Now(), start)
+}
+
+// Test timers of the fake clock.
+func TestFakeTimer(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	c := clock.NewFake(start)
+	timer := c.NewTimer(time.Minute)
+	after := c.After(2 * time.Minute)
+	assert.Equal(c.Waiters(), 2)
+
+	c.Advance(59 * time.Second)
+	assert.False(received(timer.C()), "no time sent")
+	c.Advance(2 * time.Minute)
+	assert.Equal(<-timer.C(), start.Add(time.Minute), "timer fired at its time")
+	assert.Equal(<-after, start.Add(2*time.Minute), "after fired at its time")
+	assert.Equal(c.Waiters(), 0)
+
+	assert.False(timer.Reset(time.Minute), "timer has not been active")
+	assert.True(timer.Stop(), "timer has been active")
+	c.Advance(time.Hour)
+	assert.False(received(timer.C()), "no time sent")
+
+	timer.Reset(0)
+	assert.Equal(<-timer.C(), c.Now(), "timer without duration fires immediately")
+}
+
+// Test tickers of the fake clock.
+func TestFakeTicker(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	c := clock.NewFake(start)
+	ticker := c.NewTicker(time.Second)
+
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Second)
+		assert.Equal(<-ticker.C(), start.Add(time.Duration(i)*time.Second))
+	}
+	// Missed ticks are dropped.
+	c.Advance(10 * time.Second)
+	assert.Equal(<-ticker.C(), start.Add(4*time.Second))
+	assert.False(received(ticker.C()), "no time sent")
+
+	ticker.Reset(time.Minute)
+	c.Advance(time.Minute)
+	assert.Equal(<-ticker.C(), start.Add(13*time.Second+time.Minute))
+	ticker.Stop()
+	assert.Equal(c.Waiters(), 0)
+}
+
+// Test waiting for goroutines sleeping with the fake clock.
+func TestFakeSleep(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	c := clock.NewFake(start)
+	done := make(chan time.Time)
+	go func() {
+		c.Sleep(time.Hour)
+		done <- c.Now()
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	assert.Equal(<-done, start.Add(time.Hour))
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// received checks if a time has been sent.
+func received(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// EOF
@@ -0,0 +1,37 @@
+// Tideland Go Application Support - Clock
+//
+// Copyright (C) 2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The clock package abstracts the access to the current time, timers,
+// and tickers. Packages accepting a clock use the real one by default.
+// Tests can pass a fake clock instead and advance it manually. This
+// way timeouts and schedules are tested deterministically without
+// sleeping in real time.
+//
+//	c := clock.NewFake(time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC))
+//	timer := c.NewTimer(time.Minute)
+//	c.Advance(time.Minute)
+//	t := <-timer.C()
+package clock
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v1/version"
+)
+
+//--------------------
+// VERSION
+//--------------------
+
+// PackageVersion returns the version of the version package.
+func PackageVersion() version.Version {
+	return version.New(1, 0, 0)
+}
+
+// EOF
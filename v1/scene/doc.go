@@ -77,6 +77,9 @@
 // Now the scene is stopped after 5 minutes without any access or at the
 // latest 60 minutes after the start. Both value may be zero if not needed.
 // So scene.StartLimited(0, 0) is the same as scene.Start().
+//
+// The timeouts are measured with the real clock. Tests can pass a fake
+// clock of the clock package with the option scene.WithClock(c).
 package scene
 
 //--------------------
@@ -93,7 +96,7 @@ import (
 
 // PackageVersion returns the version of the version package.
 func PackageVersion() version.Version {
-	return version.New(1, 4, 0)
+	return version.New(1, 5, 0)
 }
 
 // EOF
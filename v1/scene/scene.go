@@ -14,6 +14,7 @@ package scene
 import (
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
 	"github.com/tideland/goas/v2/identifier"
 	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/goas/v3/errors"
@@ -60,8 +61,6 @@ type envelope struct {
 	kind      int
 	box       *box
 	signaling *signaling
-	err       error
-	respChan  chan *envelope
 }
 
 // Scene is the access point to one scene. It has to be created once
@@ -107,7 +106,10 @@ type Scene interface {
 	// Dispose retrieves a prop and deletes it from the store.
 	Dispose(key string) (interface{}, error)
 
-	// Flag allows to signal a topic to interested actors.
+	// Flag allows to signal a topic to interested actors. The waiting
+	// actors are signaled before Flag returns, but their following
+	// operations on the scene may be processed after those of the
+	// flagging actor.
 	Flag(topic string) error
 
 	// Unflag drops the signal for a given topic.
@@ -131,34 +133,61 @@ type Scene interface {
 
 // scene implements Scene.
 type scene struct {
-	id          identifier.UUID
-	props       map[string]*box
-	flags       map[string]bool
-	signalings  map[string][]chan struct{}
-	inactivity  time.Duration
-	absolute    time.Duration
-	commandChan chan *envelope
-	backend     loop.Loop
+	id         identifier.UUID
+	props      map[string]*box
+	flags      map[string]bool
+	signalings map[string][]chan struct{}
+	inactivity time.Duration
+	absolute   time.Duration
+	clock      clock.Clock
+	watchdog   clock.Timer
+	active     time.Time
+	backend    *loop.Actor[*envelope, *envelope]
+}
+
+// Option allows to configure a scene when starting it.
+type Option func(s *scene)
+
+// WithClock sets the clock used for the timeouts of the scene.
+// Default is the real clock, tests can pass a fake one.
+func WithClock(c clock.Clock) Option {
+	return func(s *scene) {
+		s.clock = c
+	}
 }
 
 // Start creates and runs a new scene.
-func Start() Scene {
-	return StartLimited(0, 0)
+func Start(opts ...Option) Scene {
+	return StartLimited(0, 0, opts...)
 }
 
 // StartLimited creates and runs a new scene with an inactivity
 // and an absolute timeout. They may be zero.
-func StartLimited(inactivity, absolute time.Duration) Scene {
+func StartLimited(inactivity, absolute time.Duration, opts ...Option) Scene {
 	s := &scene{
-		id:          identifier.NewUUID(),
-		props:       make(map[string]*box),
-		flags:       make(map[string]bool),
-		signalings:  make(map[string][]chan struct{}),
-		inactivity:  inactivity,
-		absolute:    absolute,
-		commandChan: make(chan *envelope, 1),
+		id:         identifier.NewUUID(),
+		props:      make(map[string]*box),
+		flags:      make(map[string]bool),
+		signalings: make(map[string][]chan struct{}),
+		inactivity: inactivity,
+		absolute:   absolute,
+		clock:      clock.Real(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	var clapperboard clock.Timer
+	if s.inactivity > 0 {
+		s.watchdog = s.clock.NewTimer(s.inactivity)
+		s.active = s.clock.Now()
+	}
+	if s.absolute > 0 {
+		clapperboard = s.clock.NewTimer(s.absolute)
+	}
+	s.backend = loop.GoActor(s.processCommand, 1, loop.WithClock(s.clock), loop.WithFinalizer(s.finalize))
+	if s.watchdog != nil || clapperboard != nil {
+		go s.watch(clapperboard)
 	}
-	s.backend = loop.Go(s.backendLoop)
 	return s
 }
 
@@ -210,7 +239,6 @@ func (s *scene) StoreClean(key string, prop interface{}, cleanup CleanupFunc) er
 			prop:    prop,
 			cleanup: cleanup,
 		},
-		respChan: make(chan *envelope, 1),
 	}
 	_, err := s.command(command)
 	return err
@@ -232,7 +260,6 @@ func (s *scene) Fetch(key string) (interface{}, error) {
 		box: &box{
 			key: key,
 		},
-		respChan: make(chan *envelope, 1),
 	}
 	resp, err := s.command(command)
 	if err != nil {
@@ -248,7 +275,6 @@ func (s *scene) Dispose(key string) (interface{}, error) {
 		box: &box{
 			key: key,
 		},
-		respChan: make(chan *envelope, 1),
 	}
 	resp, err := s.command(command)
 	if err != nil {
@@ -264,7 +290,6 @@ func (s *scene) Flag(topic string) error {
 		signaling: &signaling{
 			topic: topic,
 		},
-		respChan: make(chan *envelope, 1),
 	}
 	_, err := s.command(command)
 	return err
@@ -277,7 +302,6 @@ func (s *scene) Unflag(topic string) error {
 		signaling: &signaling{
 			topic: topic,
 		},
-		respChan: make(chan *envelope, 1),
 	}
 	_, err := s.command(command)
 	return err
@@ -306,7 +330,6 @@ func (s *scene) WaitFlagLimited(topic string, timeout time.Duration) error {
 			topic:      topic,
 			signalChan: make(chan struct{}, 1),
 		},
-		respChan: make(chan *envelope, 1),
 	}
 	_, err := s.command(command)
 	if err != nil {
@@ -315,15 +338,13 @@ func (s *scene) WaitFlagLimited(topic string, timeout time.Duration) error {
 	// Wait for signal.
 	var timeoutChan <-chan time.Time
 	if timeout > 0 {
-		timeoutChan = time.After(timeout)
+		timer := s.clock.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C()
 	}
 	select {
 	case <-s.backend.IsStopping():
-		err = s.Wait()
-		if err == nil {
-			err = errors.New(ErrSceneEnded, errorMessages)
-		}
-		return err
+		return s.endedError()
 	case <-command.signaling.signalChan:
 		return nil
 	case <-timeoutChan:
@@ -343,95 +364,86 @@ func (s *scene) WaitFlagLimitedAndFetch(topic string, timeout time.Duration) (in
 // command sends a command envelope to the backend and
 // waits for the response.
 func (s *scene) command(command *envelope) (*envelope, error) {
-	select {
-	case s.commandChan <- command:
-	case <-s.backend.IsStopping():
-		err := s.Wait()
-		if err == nil {
-			err = errors.New(ErrSceneEnded, errorMessages)
-		}
-		return nil, err
+	resp, err := s.backend.Call(command)
+	if loop.IsActorStoppedError(err) {
+		return nil, s.endedError()
 	}
-	select {
-	case <-s.backend.IsStopping():
-		err := s.Wait()
-		if err == nil {
-			err = errors.New(ErrSceneEnded, errorMessages)
-		}
-		return nil, err
-	case resp := <-command.respChan:
-		if resp.err != nil {
-			return nil, resp.err
-		}
-		return resp, nil
+	return resp, err
+}
+
+// endedError returns the error of the ended scene or that
+// it ended if there's none.
+func (s *scene) endedError() error {
+	err := s.Wait()
+	if err == nil {
+		err = errors.New(ErrSceneEnded, errorMessages)
 	}
+	return err
 }
 
-// backendLoop runs the backend loop of the scene.
-func (s *scene) backendLoop(l loop.Loop) (err error) {
-	// Defer cleanup.
-	defer func() {
-		cerr := s.cleanupAllProps()
-		if err == nil {
-			err = cerr
-		}
-	}()
-	// Init timers.
-	var watchdog <-chan time.Time
-	var clapperboard <-chan time.Time
-	if s.absolute > 0 {
-		clapperboard = time.After(s.absolute)
+// watch kills the backend of the scene when the inactivity
+// or the absolute timeout is reached.
+func (s *scene) watch(clapperboard clock.Timer) {
+	var watchdogChan <-chan time.Time
+	var clapperboardChan <-chan time.Time
+	if s.watchdog != nil {
+		defer s.watchdog.Stop()
+		watchdogChan = s.watchdog.C()
 	}
-	// Run loop.
-	for {
-		if s.inactivity > 0 {
-			watchdog = time.After(s.inactivity)
-		}
-		select {
-		case <-l.ShallStop():
-			return nil
-		case timeout := <-watchdog:
-			return errors.New(ErrTimeout, errorMessages, "inactivity", timeout)
-		case timeout := <-clapperboard:
-			return errors.New(ErrTimeout, errorMessages, "absolute", timeout)
-		case command := <-s.commandChan:
-			s.processCommand(command)
-		}
+	if clapperboard != nil {
+		defer clapperboard.Stop()
+		clapperboardChan = clapperboard.C()
+	}
+	select {
+	case <-s.backend.IsStopping():
+	case timeout := <-watchdogChan:
+		s.backend.Kill(errors.New(ErrTimeout, errorMessages, "inactivity", timeout))
+	case timeout := <-clapperboardChan:
+		s.backend.Kill(errors.New(ErrTimeout, errorMessages, "absolute", timeout))
 	}
 }
 
-// processCommand processes the sent commands.
-func (s *scene) processCommand(command *envelope) {
+// processCommand processes the sent commands inside the backend.
+func (s *scene) processCommand(command *envelope) (*envelope, error) {
+	if s.watchdog != nil {
+		now := s.clock.Now()
+		if !s.watchdog.Stop() || now.Sub(s.active) >= s.inactivity {
+			// Inactivity timeout reached before the command, even
+			// if the watchdog hasn't been delivered yet.
+			err := errors.New(ErrTimeout, errorMessages, "inactivity", now)
+			s.backend.Kill(err)
+			return nil, err
+		}
+		s.active = now
+		s.watchdog.Reset(s.inactivity)
+	}
 	switch command.kind {
 	case storeProp:
 		// Add a new prop.
 		_, ok := s.props[command.box.key]
 		if ok {
-			command.err = errors.New(ErrPropAlreadyExist, errorMessages, command.box.key)
-		} else {
-			s.props[command.box.key] = command.box
+			return nil, errors.New(ErrPropAlreadyExist, errorMessages, command.box.key)
 		}
+		s.props[command.box.key] = command.box
 	case fetchProp:
 		// Retrieve a prop.
 		box, ok := s.props[command.box.key]
 		if !ok {
-			command.err = errors.New(ErrPropNotFound, errorMessages, command.box.key)
-		} else {
-			command.box = box
+			return nil, errors.New(ErrPropNotFound, errorMessages, command.box.key)
 		}
+		command.box = box
 	case disposeProp:
 		// Remove a prop.
 		box, ok := s.props[command.box.key]
 		if !ok {
-			command.err = errors.New(ErrPropNotFound, errorMessages, command.box.key)
-		} else {
-			delete(s.props, command.box.key)
-			command.box = box
-			if box.cleanup != nil {
-				cerr := box.cleanup(box.key, box.prop)
-				if cerr != nil {
-					command.err = errors.Annotate(cerr, ErrCleanupFailed, errorMessages, box.key)
-				}
+			return nil, errors.New(ErrPropNotFound, errorMessages, command.box.key)
+		}
+		delete(s.props, command.box.key)
+		command.box = box
+		if box.cleanup != nil {
+			cerr := box.cleanup(box.key, box.prop)
+			if cerr != nil {
+				return nil, errors.Annotate(cerr, ErrCleanupFailed, errorMessages, box.key)
 			}
 		}
 	case flag:
@@ -461,7 +473,17 @@ func (s *scene) processCommand(command *envelope) {
 		panic("illegal command")
 	}
 	// Return the changed command as response.
-	command.respChan <- command
+	return command, nil
+}
+
+// finalize cleans all props after the backend ended. An error
+// of the cleanup is returned if the backend ended without one.
+func (s *scene) finalize(err error) error {
+	cerr := s.cleanupAllProps()
+	if err == nil {
+		return cerr
+	}
+	return err
 }
 
 // cleanupAllProps cleans all props.
@@ -16,6 +16,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
 	"github.com/tideland/goas/v1/scene"
 	"github.com/tideland/gots/v3/asserts"
 )
@@ -187,6 +188,43 @@ func TestSimpleAbsoluteTimeout(t *testing.T) {
 	assert.True(scene.IsTimeoutError(err))
 }
 
+// TestTimeoutClock tests the timeouts with a fake clock.
+func TestTimeoutClock(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, false)
+	c := clock.NewFake(time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC))
+
+	scn := scene.StartLimited(time.Minute, time.Hour, scene.WithClock(c))
+	c.BlockUntil(2)
+	err := scn.Store("foo", 4711)
+	assert.Nil(err)
+	for i := 0; i < 5; i++ {
+		c.Advance(59 * time.Second)
+		_, err = scn.Fetch("foo")
+		assert.Nil(err)
+	}
+	c.Advance(time.Minute)
+	err = scn.Wait()
+	assert.True(scene.IsTimeoutError(err))
+	assert.ErrorMatch(err, ".*inactivity timeout.*")
+
+	scn = scene.StartLimited(0, time.Hour, scene.WithClock(c))
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	err = scn.Wait()
+	assert.True(scene.IsTimeoutError(err))
+	assert.ErrorMatch(err, ".*absolute timeout.*")
+
+	scn = scene.Start(scene.WithClock(c))
+	errc := make(chan error)
+	go func() {
+		errc <- scn.WaitFlagLimited("foo", time.Minute)
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	assert.True(scene.IsWaitedTooLongError(<-errc))
+	assert.Nil(scn.Stop())
+}
+
 // TestCleanupAfterTimeout tests the cleanup of props after
 // a timeout.
 func TestCleanupAfterTimeout(t *testing.T) {
@@ -353,14 +391,18 @@ func TestEarlyFlag(t *testing.T) {
 func TestFlagTimeout(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, false)
 	scn := scene.Start()
+	doneA := make(chan struct{})
+	doneB := make(chan struct{})
 
 	go func() {
+		defer close(doneA)
 		err := scn.WaitFlag("foo")
 		assert.Nil(err)
 		err = scn.Store("foo-a", true)
 		assert.Nil(err)
 	}()
 	go func() {
+		defer close(doneB)
 		err := scn.WaitFlagLimited("foo", 50*time.Millisecond)
 		assert.True(scene.IsWaitedTooLongError(err))
 		err = scn.Store("foo-b", true)
@@ -372,6 +414,10 @@ func TestFlagTimeout(t *testing.T) {
 	err := scn.Flag("foo")
 	assert.Nil(err)
 
+	// The waiters store after being signaled.
+	<-doneA
+	<-doneB
+
 	fooA, err := scn.Fetch("foo-a")
 	assert.Nil(err)
 	assert.Equal(fooA, true)
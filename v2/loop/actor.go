@@ -0,0 +1,209 @@
+// Tideland Go Application Support - Loop - Actor
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// ACTOR
+//--------------------
+
+// Handler processes the requests of an actor one after another
+// inside the actor's goroutine and returns the responses.
+type Handler[Req, Resp any] func(req Req) (Resp, error)
+
+// actorResult is the response of an actor to a call.
+type actorResult[Resp any] struct {
+	resp Resp
+	err  error
+}
+
+// actorMessage is one request in the mailbox of an actor. Casts
+// have no result channel.
+type actorMessage[Req, Resp any] struct {
+	req        Req
+	resultChan chan actorResult[Resp]
+}
+
+// Actor serializes the processing of typed requests in a loop. So
+// the state of the handler needs no further protection. Requests
+// can be called waiting for the response or cast without reply.
+type Actor[Req, Resp any] struct {
+	handler  Handler[Req, Resp]
+	mailbox  chan *actorMessage[Req, Resp]
+	doneChan chan struct{}
+	loop     Loop
+}
+
+// GoActor starts an actor processing the requests with the handler.
+// The mailbox size defines how many requests are buffered before
+// callers block. A panicking handler is recovered and the panic is
+// returned as error to the caller. The options are those of the loop
+// running the actor.
+func GoActor[Req, Resp any](h Handler[Req, Resp], mailboxSize int, opts ...Option) *Actor[Req, Resp] {
+	if mailboxSize < 0 {
+		mailboxSize = 0
+	}
+	a := &Actor[Req, Resp]{
+		handler:  h,
+		mailbox:  make(chan *actorMessage[Req, Resp], mailboxSize),
+		doneChan: make(chan struct{}),
+	}
+	a.loop = Go(a.backendLoop, opts...)
+	return a
+}
+
+// Call passes a request to the actor and waits for the response.
+func (a *Actor[Req, Resp]) Call(req Req) (Resp, error) {
+	return a.CallContext(context.Background(), req)
+}
+
+// CallTimeout passes a request to the actor and waits for the
+// response only for the passed duration.
+func (a *Actor[Req, Resp]) CallTimeout(req Req, timeout time.Duration) (Resp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return a.CallContext(ctx, req)
+}
+
+// CallContext passes a request to the actor and waits for the
+// response until the context is done. A request already passed
+// to the actor will be processed anyway.
+func (a *Actor[Req, Resp]) CallContext(ctx context.Context, req Req) (Resp, error) {
+	var zero Resp
+	m := &actorMessage[Req, Resp]{
+		req:        req,
+		resultChan: make(chan actorResult[Resp], 1),
+	}
+	if err := a.send(ctx, m); err != nil {
+		return zero, err
+	}
+	select {
+	case r := <-m.resultChan:
+		return r.resp, r.err
+	case <-a.doneChan:
+		// Result may have been sent before the actor ended.
+		select {
+		case r := <-m.resultChan:
+			return r.resp, r.err
+		default:
+			return zero, errors.New(ErrActorStopped, errorMessages)
+		}
+	case <-ctx.Done():
+		return zero, errors.Annotate(context.Cause(ctx), ErrActorTimeout, errorMessages)
+	}
+}
+
+// Cast passes a request to the actor without waiting for the
+// response. It only blocks if the mailbox is full.
+func (a *Actor[Req, Resp]) Cast(req Req) error {
+	return a.send(context.Background(), &actorMessage[Req, Resp]{req: req})
+}
+
+// Stop stops the actor. Requests still in the mailbox are answered
+// with an error.
+func (a *Actor[Req, Resp]) Stop() error {
+	return a.loop.Stop()
+}
+
+// Kill stops the actor due to the passed error. Only the first
+// error is stored.
+func (a *Actor[Req, Resp]) Kill(err error) {
+	a.loop.Kill(err)
+}
+
+// Wait blocks the caller until the actor ended and returns the error.
+func (a *Actor[Req, Resp]) Wait() error {
+	return a.loop.Wait()
+}
+
+// Error returns the current status and error of the actor.
+func (a *Actor[Req, Resp]) Error() (int, error) {
+	return a.loop.Error()
+}
+
+// IsStopping returns a channel closed when the actor is stopping.
+func (a *Actor[Req, Resp]) IsStopping() <-chan struct{} {
+	return a.loop.IsStopping()
+}
+
+// send puts a message into the mailbox.
+func (a *Actor[Req, Resp]) send(ctx context.Context, m *actorMessage[Req, Resp]) error {
+	select {
+	case <-a.doneChan:
+		return errors.New(ErrActorStopped, errorMessages)
+	default:
+	}
+	select {
+	case a.mailbox <- m:
+		return nil
+	case <-a.doneChan:
+		return errors.New(ErrActorStopped, errorMessages)
+	case <-ctx.Done():
+		return errors.Annotate(context.Cause(ctx), ErrActorTimeout, errorMessages)
+	}
+}
+
+// backendLoop runs the actor.
+func (a *Actor[Req, Resp]) backendLoop(l Loop) error {
+	defer a.drain()
+	for {
+		// Stopping has priority over the mailbox.
+		select {
+		case <-l.ShallStop():
+			return nil
+		default:
+		}
+		select {
+		case <-l.ShallStop():
+			return nil
+		case m := <-a.mailbox:
+			resp, err := a.process(m.req)
+			if m.resultChan != nil {
+				m.resultChan <- actorResult[Resp]{resp, err}
+			}
+		}
+	}
+}
+
+// process lets the handler process one request.
+func (a *Actor[Req, Resp]) process(req Req) (resp Resp, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(ErrActorPanicked, errorMessages, r)
+		}
+	}()
+	return a.handler(req)
+}
+
+// drain signals the end of the actor and answers the requests
+// left in the mailbox.
+func (a *Actor[Req, Resp]) drain() {
+	close(a.doneChan)
+	for {
+		select {
+		case m := <-a.mailbox:
+			if m.resultChan != nil {
+				m.resultChan <- actorResult[Resp]{err: errors.New(ErrActorStopped, errorMessages)}
+			}
+		default:
+			return
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,62 @@
+// Tideland Go Application Support - Loop - Backoff
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math/rand"
+	"time"
+)
+
+//--------------------
+// BACKOFF
+//--------------------
+
+// Backoff returns the delay before the restart of a recoverable
+// loop. The passed recoverings contain the current one as last.
+// As the RecoverFunc may trim the recoverings it also controls
+// when the delay is reset.
+type Backoff func(rs Recoverings) time.Duration
+
+// FixedBackoff always returns the same delay.
+func FixedBackoff(delay time.Duration) Backoff {
+	return func(rs Recoverings) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff doubles the delay for each recovering, starting
+// with initial and capped by max. A jitter between 0.0 and 1.0
+// randomly reduces the delay by up to this fraction to avoid many
+// loops restarting at the same time.
+func ExponentialBackoff(initial, max time.Duration, jitter float64) Backoff {
+	if jitter < 0.0 {
+		jitter = 0.0
+	}
+	if jitter > 1.0 {
+		jitter = 1.0
+	}
+	return func(rs Recoverings) time.Duration {
+		delay := initial
+		for i := 1; i < rs.Len() && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		if jitter > 0.0 {
+			delay -= time.Duration(jitter * rand.Float64() * float64(delay))
+		}
+		return delay
+	}
+}
+
+// EOF
@@ -28,7 +28,7 @@ import (
 
 // PackageVersion returns the version of the version package.
 func PackageVersion() version.Version {
-	return version.New(2, 1, 3)
+	return version.New(2, 14, 0)
 }
 
 // EOF
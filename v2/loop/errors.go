@@ -0,0 +1,184 @@
+// Tideland Go Application Support - Loop
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	ErrSupervisorStopped = iota + 1
+	ErrDuplicateChild
+	ErrStartFailed
+	ErrTooManyRestarts
+	ErrStopTimeout
+	ErrLoopsStuck
+	ErrLoopPanicked
+	ErrActorStopped
+	ErrActorTimeout
+	ErrActorPanicked
+	ErrPoolStopped
+	ErrQueueFull
+	ErrJobPanicked
+	ErrTickerStopped
+	ErrGroupFailed
+	ErrGroupKilled
+	ErrMemberFailed
+	ErrLoopNotRunning
+	ErrInvalidInterval
+)
+
+var errorMessages = errors.Messages{
+	ErrSupervisorStopped: "supervisor is stopped",
+	ErrDuplicateChild:    "child %q already exists",
+	ErrStartFailed:       "cannot start child %q",
+	ErrTooManyRestarts:   "too many restarts, last of child %q: %v",
+	ErrStopTimeout:       "loop %q did not stop in time",
+	ErrLoopsStuck:        "loops did not stop in time: %s",
+	ErrLoopPanicked:      "loop panicked: %v",
+	ErrActorStopped:      "actor is stopped",
+	ErrActorTimeout:      "actor call timed out",
+	ErrActorPanicked:     "actor handler panicked: %v",
+	ErrPoolStopped:       "pool is stopped",
+	ErrQueueFull:         "job queue of pool is full",
+	ErrJobPanicked:       "job panicked: %v",
+	ErrTickerStopped:     "ticker is stopped",
+	ErrGroupFailed:       "group already failed due to member %q",
+	ErrGroupKilled:       "killed due to failed member %q",
+	ErrMemberFailed:      "group member %q failed",
+	ErrLoopNotRunning:    "loop is not running",
+	ErrInvalidInterval:   "invalid ticker interval %v",
+}
+
+//--------------------
+// TESTING
+//--------------------
+
+// IsSupervisorStoppedError returns true, if the error signals that
+// a supervisor has already been stopped.
+func IsSupervisorStoppedError(err error) bool {
+	return errors.IsError(err, ErrSupervisorStopped)
+}
+
+// IsDuplicateChildError returns true, if the error signals that
+// a child with the same ID is already supervised.
+func IsDuplicateChildError(err error) bool {
+	return errors.IsError(err, ErrDuplicateChild)
+}
+
+// IsStartFailedError returns true, if the error signals that
+// a child of a supervisor could not be started.
+func IsStartFailedError(err error) bool {
+	return errors.IsError(err, ErrStartFailed)
+}
+
+// IsTooManyRestartsError returns true, if the error signals that
+// the children of a supervisor restarted too often.
+func IsTooManyRestartsError(err error) bool {
+	return errors.IsError(err, ErrTooManyRestarts)
+}
+
+// IsStopTimeoutError returns true, if the error signals that
+// a loop did not stop in time.
+func IsStopTimeoutError(err error) bool {
+	return errors.IsError(err, ErrStopTimeout)
+}
+
+// IsLoopsStuckError returns true, if the error signals that
+// registered loops did not stop in time.
+func IsLoopsStuckError(err error) bool {
+	return errors.IsError(err, ErrLoopsStuck)
+}
+
+// IsLoopPanickedError returns true, if the error signals that
+// a loop panicked while stopping.
+func IsLoopPanickedError(err error) bool {
+	return errors.IsError(err, ErrLoopPanicked)
+}
+
+// IsActorStoppedError returns true, if the error signals that
+// an actor has been stopped before processing a request.
+func IsActorStoppedError(err error) bool {
+	return errors.IsError(err, ErrActorStopped)
+}
+
+// IsActorTimeoutError returns true, if the error signals that
+// a call of an actor timed out.
+func IsActorTimeoutError(err error) bool {
+	return errors.IsError(err, ErrActorTimeout)
+}
+
+// IsActorPanickedError returns true, if the error signals that
+// the handler of an actor panicked while processing a request.
+func IsActorPanickedError(err error) bool {
+	return errors.IsError(err, ErrActorPanicked)
+}
+
+// IsPoolStoppedError returns true, if the error signals that
+// a pool has been stopped before executing a job.
+func IsPoolStoppedError(err error) bool {
+	return errors.IsError(err, ErrPoolStopped)
+}
+
+// IsQueueFullError returns true, if the error signals that
+// the job queue of a pool is full.
+func IsQueueFullError(err error) bool {
+	return errors.IsError(err, ErrQueueFull)
+}
+
+// IsJobPanickedError returns true, if the error signals that
+// a job executed by a pool panicked.
+func IsJobPanickedError(err error) bool {
+	return errors.IsError(err, ErrJobPanicked)
+}
+
+// IsTickerStoppedError returns true, if the error signals that
+// a ticker is already stopped.
+func IsTickerStoppedError(err error) bool {
+	return errors.IsError(err, ErrTickerStopped)
+}
+
+// IsGroupFailedError returns true, if the error signals that
+// a loop cannot be added to a failed group.
+func IsGroupFailedError(err error) bool {
+	return errors.IsError(err, ErrGroupFailed)
+}
+
+// IsGroupKilledError returns true, if the error signals that
+// a group member has been killed due to another failed member.
+func IsGroupKilledError(err error) bool {
+	return errors.IsError(err, ErrGroupKilled)
+}
+
+// IsMemberFailedError returns true, if the error signals that
+// a member of a group failed.
+func IsMemberFailedError(err error) bool {
+	return errors.IsError(err, ErrMemberFailed)
+}
+
+// IsLoopNotRunningError returns true, if the error signals that
+// a loop cannot be paused or resumed as it is not running anymore.
+func IsLoopNotRunningError(err error) bool {
+	return errors.IsError(err, ErrLoopNotRunning)
+}
+
+// IsInvalidIntervalError returns true, if the error signals that
+// the interval of a ticker is not positive.
+func IsInvalidIntervalError(err error) bool {
+	return errors.IsError(err, ErrInvalidInterval)
+}
+
+// EOF
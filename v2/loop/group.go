@@ -0,0 +1,139 @@
+// Tideland Go Application Support - Loop - Group
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// GROUP
+//--------------------
+
+// MemberResult describes the current state of a group member.
+type MemberResult struct {
+	Name   string
+	Status int
+	Err    error
+}
+
+// member is one loop of a group.
+type member struct {
+	name string
+	loop *loop
+}
+
+// Group runs cooperating loops. If one of them ends with an error
+// all others are killed.
+type Group struct {
+	mux     sync.Mutex
+	wg      sync.WaitGroup
+	members []*member
+	failed  *member
+	err     error
+}
+
+// NewGroup creates an empty group.
+func NewGroup() *Group {
+	return &Group{}
+}
+
+// Go starts the loop function as member of the group. The name
+// identifies the member in the results. The options are those
+// of the member's loop. If the group already failed the loop
+// is not started.
+func (g *Group) Go(name string, lf LoopFunc, opts ...Option) error {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.failed != nil {
+		return errors.New(ErrGroupFailed, errorMessages, g.failed.name)
+	}
+	m := &member{
+		name: name,
+		loop: Go(lf, opts...).(*loop),
+	}
+	g.members = append(g.members, m)
+	g.wg.Add(1)
+	go g.watch(m)
+	return nil
+}
+
+// Stop stops all members and waits until they ended.
+func (g *Group) Stop() error {
+	for _, m := range g.snapshot() {
+		m.loop.killRunning(nil)
+	}
+	return g.Wait()
+}
+
+// Wait blocks the caller until all members ended. The returned
+// error is the first error of a member annotated with its name.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.failed == nil {
+		return nil
+	}
+	return errors.Annotate(g.err, ErrMemberFailed, errorMessages, g.failed.name)
+}
+
+// Results returns the status and the error of all members
+// in start order. Members killed due to a failed one have a
+// group killed error.
+func (g *Group) Results() []*MemberResult {
+	rs := []*MemberResult{}
+	for _, m := range g.snapshot() {
+		status, err := m.loop.Error()
+		rs = append(rs, &MemberResult{
+			Name:   m.name,
+			Status: status,
+			Err:    err,
+		})
+	}
+	return rs
+}
+
+// watch waits for the end of a member and kills the others
+// in case of an error.
+func (g *Group) watch(m *member) {
+	defer g.wg.Done()
+	err := m.loop.Wait()
+	if err == nil {
+		return
+	}
+	g.mux.Lock()
+	if g.failed != nil {
+		g.mux.Unlock()
+		return
+	}
+	g.failed = m
+	g.err = err
+	members := append([]*member{}, g.members...)
+	g.mux.Unlock()
+	for _, om := range members {
+		if om != m {
+			om.loop.killRunning(errors.New(ErrGroupKilled, errorMessages, m.name))
+		}
+	}
+}
+
+// snapshot returns a copy of the members.
+func (g *Group) snapshot() []*member {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return append([]*member{}, g.members...)
+}
+
+// EOF
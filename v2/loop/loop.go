@@ -12,8 +12,13 @@ package loop
 //--------------------
 
 import (
+	"context"
+	"io"
 	"sync"
 	"time"
+
+	"github.com/tideland/goas/v1/clock"
+	"github.com/tideland/goas/v3/errors"
 )
 
 //--------------------
@@ -25,15 +30,18 @@ const (
 	Running = iota
 	Stopping
 	Stopped
+	Paused
 )
 
 // LoopFunc is managed loop function.
 type LoopFunc func(l Loop) error
 
 // Recovering stores time and reason of one of the recoverings.
+// Delay is the time the loop waits before its restart.
 type Recovering struct {
 	Time   time.Time
 	Reason interface{}
+	Delay  time.Duration
 }
 
 // Recoverings is a list of recoverings a loop already had.
@@ -112,15 +120,171 @@ type Loop interface {
 	IsStopping() <-chan struct{}
 }
 
+// PausableLoop is a loop whose work can be paused and resumed. It's
+// implemented by the loops started with Go() and its variants, the
+// loop function has to react on the signals.
+type PausableLoop interface {
+	Loop
+
+	// Pause tells the loop to suspend its work until it is resumed.
+	Pause() error
+
+	// Resume tells a paused loop to continue its work.
+	Resume() error
+
+	// ShallPause returns a channel signalling the loop to
+	// pause its work.
+	ShallPause() <-chan struct{}
+
+	// ShallResume returns a channel signalling a paused loop
+	// to resume its work.
+	ShallResume() <-chan struct{}
+}
+
+// TimeoutLoop is a loop which can be stopped with a deadline. It's
+// implemented by the loops started with Go() and its variants.
+type TimeoutLoop interface {
+	Loop
+
+	// StopTimeout tells the loop to stop working like Stop() but
+	// waits only for the passed duration. Then the loop is abandoned
+	// and a stop timeout error is returned.
+	StopTimeout(timeout time.Duration) error
+
+	// StopContext tells the loop to stop working like Stop() but
+	// waits only until the context is done. Then the loop is abandoned
+	// and a stop timeout error is returned.
+	StopContext(ctx context.Context) error
+}
+
+// ContextLoop is a loop providing a context for its work. It's
+// implemented by the loops started with Go() and its variants, so
+// the loop function gets the context with a type assertion.
+type ContextLoop interface {
+	Loop
+
+	// Context returns a context for the work inside the loop. It is
+	// cancelled when the loop is stopped or killed, the cause is the
+	// error of the loop.
+	Context() context.Context
+}
+
 // Loop manages a loop function.
 type loop struct {
 	mux         sync.Mutex
+	obsMux      sync.Mutex
 	loopFunc    LoopFunc
 	recoverFunc RecoverFunc
 	err         error
 	status      int
 	stopChan    chan struct{}
 	doneChan    chan struct{}
+	pauseChan   chan struct{}
+	resumeChan  chan struct{}
+	ctx         context.Context
+	cancel      context.CancelCauseFunc
+	backoff     Backoff
+	recoverMode int
+	observers   []Observer
+	parent      context.Context
+	name        string
+	stackDump   io.Writer
+	goroutine   string
+	clock       clock.Clock
+	finalizer   func(err error) error
+}
+
+// Option allows to configure a loop when starting it.
+type Option func(l *loop)
+
+// WithStackDump lets the loop write the stack of its goroutine
+// to w if StopTimeout() or StopContext() time out.
+func WithStackDump(w io.Writer) Option {
+	return func(l *loop) {
+		l.stackDump = w
+	}
+}
+
+// WithClock sets the clock used for the times of recoverings and
+// events as well as for backoff delays. Default is the real clock.
+func WithClock(c clock.Clock) Option {
+	return func(l *loop) {
+		l.clock = c
+	}
+}
+
+// WithFinalizer sets a function called with the error of the loop
+// after it ended. It returns the final error of the loop, so e.g.
+// errors of a cleanup can be reported.
+func WithFinalizer(f func(err error) error) Option {
+	return func(l *loop) {
+		l.finalizer = f
+	}
+}
+
+// Modes defining what is recovered by a recoverable loop.
+const (
+	RecoverPanics = 1 << iota
+	RecoverErrors
+	RecoverAll = RecoverPanics | RecoverErrors
+)
+
+// WithRecoverMode sets what is recovered by a recoverable loop,
+// panics, returned errors, or both. Default is both. Panics not
+// recovered are not caught by the loop.
+func WithRecoverMode(mode int) Option {
+	return func(l *loop) {
+		l.recoverMode = mode
+	}
+}
+
+// WithBackoff sets the backoff policy of a recoverable loop
+// defining the delay before a restart. Default is no delay.
+func WithBackoff(b Backoff) Option {
+	return func(l *loop) {
+		l.backoff = b
+	}
+}
+
+// newLoop creates a loop for the loop function and the optional
+// recover function. Its context is derived from the parent. In case
+// of a cancelled parent the loop will be killed with the cause.
+func newLoop(parent context.Context, lf LoopFunc, rf RecoverFunc, opts []Option) *loop {
+	l := &loop{
+		loopFunc:    lf,
+		recoverFunc: rf,
+		status:      Running,
+		stopChan:    make(chan struct{}),
+		doneChan:    make(chan struct{}),
+		pauseChan:   make(chan struct{}),
+		resumeChan:  make(chan struct{}),
+		recoverMode: RecoverAll,
+		clock:       clock.Real(),
+	}
+	close(l.resumeChan)
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.parent = parent
+	l.ctx, l.cancel = context.WithCancelCause(parent)
+	return l
+}
+
+// start notifies the observers and starts the goroutine
+// of the loop.
+func (l *loop) start(f func()) {
+	l.notifyLocked(EventStarted, nil)
+	if l.parent.Done() != nil {
+		go l.watchParent()
+	}
+	go func() {
+		if l.stackDump != nil {
+			l.mux.Lock()
+			l.goroutine = goroutineID()
+			l.mux.Unlock()
+		}
+		f()
+	}()
 }
 
 // Go starts the loop function in the background. The loop can be
@@ -128,14 +292,17 @@ type loop struct {
 // Loop.ShallStop(). The loop then has to end working returning
 // a possible error. Wait() then waits until the loop ended and
 // returns the error.
-func Go(lf LoopFunc) Loop {
-	l := &loop{
-		loopFunc: lf,
-		status:   Running,
-		stopChan: make(chan struct{}),
-		doneChan: make(chan struct{}),
-	}
-	go l.singleLoop()
+func Go(lf LoopFunc, opts ...Option) Loop {
+	return GoContext(context.Background(), lf, opts...)
+}
+
+// GoContext starts the loop function in the background like Go().
+// Additionally the loop is killed when the parent context is
+// cancelled. In this case Wait() and Error() return the cause
+// of the cancellation.
+func GoContext(ctx context.Context, lf LoopFunc, opts ...Option) Loop {
+	l := newLoop(ctx, lf, nil, opts)
+	l.start(l.singleLoop)
 	return l
 }
 
@@ -145,68 +312,154 @@ func Go(lf LoopFunc) Loop {
 // a possible error. Wait() then waits until the loop ended and returns
 // the error.
 //
-// If the loop panics a Recovering is created and passed with all
-// Recoverings before to the RecoverFunc. If it returns nil the
-// loop will be started again. Otherwise the loop will be killed
-// with that error.
-func GoRecoverable(lf LoopFunc, rf RecoverFunc) Loop {
-	l := &loop{
-		loopFunc:    lf,
-		recoverFunc: rf,
-		status:      Running,
-		stopChan:    make(chan struct{}),
-		doneChan:    make(chan struct{}),
-	}
-	go l.recoverableLoop()
+// If the loop panics or returns an error while not stopping a
+// Recovering is created and passed with all Recoverings before to
+// the RecoverFunc. If it returns nil the loop will be started again,
+// after the delay of a backoff policy passed with WithBackoff().
+// Otherwise the loop will be killed with that error. WithRecoverMode()
+// allows to recover only panics or only errors. A loop returning nil
+// or an error while stopping is not recovered and ends.
+func GoRecoverable(lf LoopFunc, rf RecoverFunc, opts ...Option) Loop {
+	return GoRecoverableContext(context.Background(), lf, rf, opts...)
+}
+
+// GoRecoverableContext starts the loop function in the background
+// like GoRecoverable(). Additionally the loop is killed when the
+// parent context is cancelled. In this case Wait() and Error()
+// return the cause of the cancellation.
+func GoRecoverableContext(ctx context.Context, lf LoopFunc, rf RecoverFunc, opts ...Option) Loop {
+	l := newLoop(ctx, lf, rf, opts)
+	l.start(l.recoverableLoop)
 	return l
 }
 
+// watchParent kills the loop if the parent context is cancelled
+// before the loop ended.
+func (l *loop) watchParent() {
+	select {
+	case <-l.parent.Done():
+		l.Kill(context.Cause(l.parent))
+	case <-l.doneChan:
+	}
+}
+
 // singleLoop is the goroutine for a loop which is not recoverable.
 func (l *loop) singleLoop() {
 	defer l.done()
 	l.Kill(l.loopFunc(l))
 }
 
-// recoverableLoop is the goroutine for loops which
+// recoverableLoop is the goroutine for loops which are restarted
+// after panics or errors depending on the recover mode.
 func (l *loop) recoverableLoop() {
 	defer l.done()
-	run := true
 	rs := Recoverings{}
-	loop := func() {
-		defer func() {
-			if r := recover(); r != nil {
-				var err error
-				rs = append(rs, &Recovering{time.Now(), r})
-				if rs, err = l.recoverFunc(rs); err != nil {
-					l.Kill(err)
-					run = false
-				}
-			}
-		}()
-		err := l.loopFunc(l)
-		if err != nil {
-			rs = append(rs, &Recovering{time.Now(), err})
-			if rs, err = l.recoverFunc(rs); err != nil {
-				l.Kill(err)
-				run = false
-			}
+	for {
+		reason := l.runRecoverable()
+		if reason == nil {
+			return
+		}
+		if l.isStopping() {
+			// No restart during stopping.
+			l.Kill(reasonError(reason))
+			return
+		}
+		var delay time.Duration
+		var err error
+		if rs, delay, err = l.recovering(rs, reason); err != nil {
+			l.Kill(err)
+			return
+		}
+		if !l.sleep(delay) {
+			return
+		}
+	}
+}
+
+// runRecoverable runs the loop function once. It returns the reason
+// for a recovering or nil if the loop ended.
+func (l *loop) runRecoverable() (reason interface{}) {
+	defer func() {
+		if l.recoverMode&RecoverPanics == 0 {
+			return
+		}
+		if r := recover(); r != nil {
+			reason = r
 		}
-		l.Kill(err)
-		run = false
+	}()
+	err := l.loopFunc(l)
+	if err != nil && l.recoverMode&RecoverErrors != 0 && !l.isStopping() {
+		return err
+	}
+	l.Kill(err)
+	return nil
+}
+
+// isStopping checks if the loop is not running anymore.
+func (l *loop) isStopping() bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.status == Stopping || l.status == Stopped
+}
+
+// reasonError returns the reason of a recovering as error.
+func reasonError(reason interface{}) error {
+	if err, ok := reason.(error); ok {
+		return err
+	}
+	return errors.New(ErrLoopPanicked, errorMessages, reason)
+}
+
+// recovering adds a recovering for the reason and passes the
+// recoverings to the recover function. It returns the delay
+// before the restart or the error of the recover function.
+func (l *loop) recovering(rs Recoverings, reason interface{}) (Recoverings, time.Duration, error) {
+	r := &Recovering{
+		Time:   l.clock.Now(),
+		Reason: reason,
 	}
-	for run {
-		loop()
+	rs = append(rs, r)
+	if l.backoff != nil {
+		r.Delay = l.backoff(rs)
+	}
+	l.notifyLocked(EventRecovered, reason)
+	rs, err := l.recoverFunc(rs)
+	return rs, r.Delay, err
+}
+
+// sleep waits for the delay before a restart. It returns false
+// if the loop is stopped during the wait.
+func (l *loop) sleep(delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := l.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-l.stopChan:
+		return false
+	case <-timer.C():
+		return true
 	}
 }
 
 // done finalizes the stopping of the loop.
 func (l *loop) done() {
 	l.mux.Lock()
-	defer l.mux.Unlock()
-	if l.status == Stopping {
-		l.status = Stopped
-		close(l.doneChan)
+	if l.status != Stopping {
+		l.mux.Unlock()
+		return
 	}
+	if l.finalizer != nil {
+		err := l.err
+		l.mux.Unlock()
+		err = l.finalizer(err)
+		l.mux.Lock()
+		l.err = err
+	}
+	l.status = Stopped
+	close(l.doneChan)
+	l.notifyUnlocking(EventStopped, l.err)
 }
 
 // Stop tells the loop to stop working without a passed error and
@@ -216,15 +469,78 @@ func (l *loop) Stop() error {
 	return l.Wait()
 }
 
+// StopTimeout tells the loop to stop working like Stop() but
+// waits only for the passed duration. Then the loop is abandoned
+// and a stop timeout error is returned.
+func (l *loop) StopTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return l.StopContext(ctx)
+}
+
+// StopContext tells the loop to stop working like Stop() but
+// waits only until the context is done. Then the loop is abandoned
+// and a stop timeout error is returned.
+func (l *loop) StopContext(ctx context.Context) error {
+	l.Kill(nil)
+	select {
+	case <-l.doneChan:
+		return l.Wait()
+	default:
+	}
+	select {
+	case <-l.doneChan:
+		return l.Wait()
+	case <-ctx.Done():
+		l.dumpStack()
+		return errors.Annotate(context.Cause(ctx), ErrStopTimeout, errorMessages, l.name)
+	}
+}
+
+// dumpStack writes the stack of the loop goroutine if wanted.
+func (l *loop) dumpStack() {
+	if l.stackDump == nil {
+		return
+	}
+	l.mux.Lock()
+	id := l.goroutine
+	l.mux.Unlock()
+	io.WriteString(l.stackDump, goroutineStack(id))
+}
+
+// clockOf returns the clock of a loop.
+func clockOf(l Loop) clock.Clock {
+	if ll, ok := l.(*loop); ok {
+		return ll.clock
+	}
+	return clock.Real()
+}
+
 // Kill tells the loop to stop working due to the passed error.
 // Here only the first error will be stored for later evaluation.
 func (l *loop) Kill(err error) {
 	l.mux.Lock()
-	defer l.mux.Unlock()
 	if l.err == nil {
 		l.err = err
 	}
-	if l.status != Running {
+	l.stopUnlocking()
+}
+
+// killRunning kills the loop only if it is still running, so
+// that the error of an already ended loop is kept.
+func (l *loop) killRunning(err error) {
+	l.mux.Lock()
+	if (l.status == Running || l.status == Paused) && l.err == nil {
+		l.err = err
+	}
+	l.stopUnlocking()
+}
+
+// stopUnlocking signals a running loop to stop and releases
+// the lock.
+func (l *loop) stopUnlocking() {
+	if l.status != Running && l.status != Paused {
+		l.mux.Unlock()
 		return
 	}
 	l.status = Stopping
@@ -233,6 +549,66 @@ func (l *loop) Kill(err error) {
 	default:
 		close(l.stopChan)
 	}
+	l.cancel(l.err)
+	l.notifyUnlocking(EventStopping, l.err)
+}
+
+// Pause tells the loop to suspend its work until it is resumed.
+// The loop function has to react on the signal out of the channel
+// PausableLoop.ShallPause() and then wait for PausableLoop.ShallResume(). Pausing
+// a paused loop does nothing, pausing a stopping or stopped loop
+// returns an error.
+func (l *loop) Pause() error {
+	l.mux.Lock()
+	switch l.status {
+	case Paused:
+		l.mux.Unlock()
+		return nil
+	case Stopping, Stopped:
+		l.mux.Unlock()
+		return errors.New(ErrLoopNotRunning, errorMessages)
+	}
+	l.status = Paused
+	l.resumeChan = make(chan struct{})
+	close(l.pauseChan)
+	l.notifyUnlocking(EventPaused, nil)
+	return nil
+}
+
+// Resume tells a paused loop to continue its work. Resuming a
+// running loop does nothing, resuming a stopping or stopped loop
+// returns an error.
+func (l *loop) Resume() error {
+	l.mux.Lock()
+	switch l.status {
+	case Running:
+		l.mux.Unlock()
+		return nil
+	case Stopping, Stopped:
+		l.mux.Unlock()
+		return errors.New(ErrLoopNotRunning, errorMessages)
+	}
+	l.status = Running
+	l.pauseChan = make(chan struct{})
+	close(l.resumeChan)
+	l.notifyUnlocking(EventResumed, nil)
+	return nil
+}
+
+// ShallPause returns a channel signalling the loop to
+// pause its work.
+func (l *loop) ShallPause() <-chan struct{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.pauseChan
+}
+
+// ShallResume returns a channel signalling a paused loop
+// to resume its work.
+func (l *loop) ShallResume() <-chan struct{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.resumeChan
 }
 
 // Wait blocks the caller until the loop ended and returns the error.
@@ -266,4 +642,11 @@ func (l *loop) IsStopping() <-chan struct{} {
 	return l.stopChan
 }
 
+// Context returns a context for the work inside the loop. It is
+// cancelled when the loop is stopped or killed, the cause is the
+// error of the loop.
+func (l *loop) Context() context.Context {
+	return l.ctx
+}
+
 // EOF
@@ -12,10 +12,20 @@ package loop_test
 //--------------------
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
 	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/gots/v3/asserts"
 )
@@ -142,6 +152,1081 @@ func TestRecoveringsError(t *testing.T) {
 	assert.Equal(loop.Stopped, status, "loop is stopped")
 }
 
+// Test stopping a loop by cancelling its parent context.
+func TestContextCancel(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	ctx, cancel := context.WithCancelCause(context.Background())
+	l := loop.GoContext(ctx, generateSimpleBackend(&done))
+
+	cancel(errors.New("cancelled"))
+
+	assert.ErrorMatch(l.Wait(), "cancelled", "error has to be the cause")
+	assert.True(done, "backend has done")
+
+	status, _ := l.Error()
+
+	assert.Equal(loop.Stopped, status, "loop is stopped")
+}
+
+// Test stopping a recoverable loop by a deadline of its parent context.
+func TestRecoverableContextDeadline(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	count := 0
+	ctx, cancel := context.WithTimeout(context.Background(), longDelay)
+	defer cancel()
+	l := loop.GoRecoverableContext(ctx, generateSimplePanicBackend(&done, &count), ignorePanics)
+
+	assert.Equal(l.Wait(), context.DeadlineExceeded, "error has to be the deadline")
+	assert.True(done, "backend has done")
+}
+
+// Test the context passed to the loop function.
+func TestLoopContext(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	started := make(chan struct{})
+	l := loop.Go(func(l loop.Loop) error {
+		close(started)
+		ctx := l.(loop.ContextLoop).Context()
+		<-ctx.Done()
+		return context.Cause(ctx)
+	})
+	<-started
+
+	assert.Nil(l.(loop.ContextLoop).Context().Err(), "context is not yet cancelled")
+
+	l.Kill(errors.New("killed"))
+
+	assert.ErrorMatch(l.Wait(), "killed", "error has to be 'killed'")
+	assert.ErrorMatch(context.Cause(l.(loop.ContextLoop).Context()), "killed", "cause has to be 'killed'")
+
+	l = loop.Go(generateSimpleBackend(new(bool)))
+
+	assert.Nil(l.Stop(), "no error after simple stop")
+	assert.Equal(l.(loop.ContextLoop).Context().Err(), context.Canceled, "context is cancelled")
+}
+
+// Test the recovering of errors and panics with the different modes.
+func TestRecoverModes(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	tests := []struct {
+		mode     int
+		panics   bool
+		count    int
+		recovers int
+		err      string
+	}{
+		{loop.RecoverAll, false, 3, 2, ""},
+		{loop.RecoverAll, true, 3, 2, ""},
+		{loop.RecoverErrors, false, 3, 2, ""},
+		{loop.RecoverPanics, true, 3, 2, ""},
+		{loop.RecoverPanics, false, 1, 0, "failed"},
+	}
+	for i, test := range tests {
+		count := 0
+		recovers := 0
+		rf := func(rs loop.Recoverings) (loop.Recoverings, error) {
+			recovers++
+			return rs, nil
+		}
+		l := loop.GoRecoverable(generateFailingBackend(&count, 2, test.panics), rf,
+			loop.WithRecoverMode(test.mode))
+
+		time.Sleep(longDelay)
+		err := l.Stop()
+		msg := fmt.Sprintf("test %d", i)
+
+		assert.Equal(count, test.count, msg, "loop function calls")
+		assert.Equal(recovers, test.recovers, msg, "recoverings")
+		if test.err == "" {
+			assert.Nil(err, msg, "no error")
+		} else {
+			assert.ErrorMatch(err, test.err, msg, "loop error")
+		}
+	}
+}
+
+// Test that unrecovered panics are not caught.
+func TestRecoverModeUncaughtPanic(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	if os.Getenv("LOOP_UNCAUGHT_PANIC") == "1" {
+		count := 0
+		l := loop.GoRecoverable(generateFailingBackend(&count, 1, true), ignorePanics,
+			loop.WithRecoverMode(loop.RecoverErrors))
+		l.Wait()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRecoverModeUncaughtPanic$")
+	cmd.Env = append(os.Environ(), "LOOP_UNCAUGHT_PANIC=1")
+	out, err := cmd.CombinedOutput()
+
+	assert.NotNil(err, "process crashed")
+	assert.Match(string(out), `(?s).*panic: failed.*generateFailingBackend.*`)
+}
+
+// Test the ending of recoverable loops without recovering.
+func TestRecoverableEnding(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	recovers := 0
+	rf := func(rs loop.Recoverings) (loop.Recoverings, error) {
+		recovers++
+		return rs, nil
+	}
+
+	// Returning nil ends the loop.
+	l := loop.GoRecoverable(func(l loop.Loop) error { return nil }, rf)
+
+	assert.Nil(l.Wait(), "no error")
+
+	// Returning an error while stopping ends the loop.
+	l = loop.GoRecoverable(func(l loop.Loop) error {
+		<-l.ShallStop()
+		return errors.New("stopping")
+	}, rf)
+
+	assert.ErrorMatch(l.Stop(), "stopping", "error while stopping")
+
+	// Panicking while stopping ends the loop.
+	l = loop.GoRecoverable(func(l loop.Loop) error {
+		<-l.ShallStop()
+		panic("stopping")
+	}, rf)
+
+	err := l.Stop()
+
+	assert.True(loop.IsLoopPanickedError(err), "panic while stopping")
+	assert.ErrorMatch(err, ".*loop panicked: stopping")
+	assert.Equal(recovers, 0, "nothing recovered")
+}
+
+// Test the delays of backoff policies.
+func TestBackoff(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rs := loop.Recoverings{}
+	fixed := loop.FixedBackoff(shortDelay)
+	exp := loop.ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond, 0.0)
+	jittered := loop.ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond, 0.5)
+	expected := []time.Duration{10, 20, 40, 50, 50}
+
+	for i, e := range expected {
+		rs = append(rs, &loop.Recovering{Time: time.Now(), Reason: i})
+
+		assert.Equal(fixed(rs), shortDelay, "fixed delay")
+		assert.Equal(exp(rs), e*time.Millisecond, "exponential delay")
+		d := jittered(rs)
+		assert.True(d > e*time.Millisecond/2-1 && d <= e*time.Millisecond, "jittered delay")
+	}
+}
+
+// Test the restart delay of a recoverable loop.
+func TestRecoverableBackoff(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	count := 0
+	delays := []time.Duration{}
+	rf := func(rs loop.Recoverings) (loop.Recoverings, error) {
+		delays = append(delays, rs.Last().Delay)
+		return rs, nil
+	}
+	l := loop.GoRecoverable(generateSimplePanicBackend(&done, &count), rf,
+		loop.WithBackoff(loop.ExponentialBackoff(shortDelay, veryLongDelay, 0.0)))
+
+	// Panics after 20, 60, and 120 milliseconds, next restart after 200.
+	time.Sleep(3 * longDelay)
+
+	assert.Nil(l.Stop(), "no error after simple stop")
+	assert.Equal(count, 3, "loop restarted only twice")
+	assert.Equal(delays, []time.Duration{shortDelay, 2 * shortDelay, 4 * shortDelay}, "delays are reported")
+}
+
+// Test the backoff delay with a fake clock.
+func TestBackoffClock(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	start := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+	rsc := make(chan loop.Recoverings, 1)
+	count := 0
+	l := loop.GoRecoverable(generateFailingBackend(&count, 1, false), func(rs loop.Recoverings) (loop.Recoverings, error) {
+		rsc <- rs
+		return rs, nil
+	}, loop.WithBackoff(loop.FixedBackoff(time.Hour)), loop.WithClock(c))
+
+	rs := <-rsc
+	assert.Equal(rs.Last().Time, start, "time of the fake clock")
+	assert.Equal(rs.Last().Delay, time.Hour)
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	time.Sleep(shortDelay)
+
+	assert.Nil(l.Stop())
+	assert.Equal(count, 2, "restarted after the delay")
+}
+
+// Test stopping a recoverable loop during the restart delay.
+func TestStopDuringBackoff(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	count := 0
+	l := loop.GoRecoverable(generateSimplePanicBackend(&done, &count), ignorePanics,
+		loop.WithBackoff(loop.FixedBackoff(time.Minute)))
+
+	time.Sleep(longDelay)
+	now := time.Now()
+
+	assert.Nil(l.Stop(), "no error after simple stop")
+	assert.True(time.Since(now) < shortDelay, "stopped without waiting")
+	assert.Equal(count, 1, "loop not restarted")
+}
+
+// Test the lifecycle events of a loop.
+func TestObserver(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	count := 0
+	kinds := []string{}
+	observer := func(e *loop.Event) {
+		kinds = append(kinds, e.String())
+		assert.False(e.Time.IsZero(), "event has a time")
+		if e.Kind == loop.EventRecovered {
+			assert.Equal(e.Reason, "ouch", "reason of the recovering")
+		}
+	}
+	l := loop.GoRecoverable(generateSimplePanicBackend(&done, &count), ignorePanics,
+		loop.WithObserver(observer))
+
+	time.Sleep(longDelay)
+	l.Kill(errors.New("killed"))
+
+	assert.ErrorMatch(l.Wait(), "killed", "error has to be 'killed'")
+	assert.Equal(kinds, []string{"started", "recovered", "recovered", "stopping", "stopped"}, "all events observed")
+}
+
+// Test the lifecycle events of a loop passed to a channel.
+func TestEvents(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	ec := make(chan *loop.Event, 10)
+	l := loop.Go(generateSimpleBackend(&done), loop.WithEvents(ec))
+
+	assert.Nil(l.Stop(), "no error after simple stop")
+
+	for _, kind := range []int{loop.EventStarted, loop.EventStopping, loop.EventStopped} {
+		var e *loop.Event
+		select {
+		case e = <-ec:
+		case <-time.After(longDelay):
+		}
+		assert.NotNil(e, "event received")
+		assert.Equal(e.Kind, kind, "event kind")
+		assert.Nil(e.Reason, "no reason")
+	}
+}
+
+// Test pausing and resuming a loop.
+func TestPauseResume(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	ticks := make(chan struct{}, 1000)
+	ec := make(chan *loop.Event, 10)
+	l := loop.Go(generatePausableBackend(ticks), loop.WithEvents(ec)).(loop.PausableLoop)
+
+	time.Sleep(shortDelay)
+	assert.Nil(l.Pause())
+	assert.Nil(l.Pause(), "pausing twice is ok")
+	status, _ := l.Error()
+	assert.Equal(status, loop.Paused)
+	time.Sleep(shortDelay)
+	drainTicks(ticks)
+	time.Sleep(longDelay)
+	assert.Equal(drainTicks(ticks), 0, "no ticks while paused")
+
+	assert.Nil(l.Resume())
+	status, _ = l.Error()
+	assert.Equal(status, loop.Running)
+	time.Sleep(longDelay)
+	assert.True(drainTicks(ticks) > 0, "ticks after resume")
+
+	assert.Nil(l.Pause())
+	assert.Nil(l.Stop(), "stopping a paused loop")
+	assert.True(loop.IsLoopNotRunningError(l.Pause()), "pausing a stopped loop")
+	assert.True(loop.IsLoopNotRunningError(l.Resume()), "resuming a stopped loop")
+
+	kinds := []string{}
+	for len(kinds) < 6 {
+		select {
+		case e := <-ec:
+			kinds = append(kinds, e.String())
+		case <-time.After(longDelay):
+			t.Fatalf("missing events after %v", kinds)
+		}
+	}
+	assert.Equal(kinds, []string{"started", "paused", "resumed", "paused", "stopping", "stopped"})
+}
+
+// Test the registry of named loops.
+func TestRegistry(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	count := 0
+	stops := []string{}
+	stopping := func(name string) loop.Option {
+		return loop.WithObserver(func(e *loop.Event) {
+			if e.Kind == loop.EventStopping {
+				stops = append(stops, name)
+			}
+		})
+	}
+	la := loop.Go(generateSimpleBackend(new(bool)), loop.WithName("a"), stopping("a"))
+	lb := loop.GoRecoverable(generateSimplePanicBackend(new(bool), &count), ignorePanics,
+		loop.WithName("b"), stopping("b"))
+	loop.Go(generateSimpleBackend(new(bool)), loop.WithName("c"), stopping("c"))
+
+	time.Sleep(longDelay)
+
+	infos := loop.Loops()
+	assert.Length(infos, 3)
+	assert.Equal(infos[0].Name, "a")
+	assert.Equal(infos[0].Status, loop.Running)
+	assert.Equal(infos[0].Recoverings, 0)
+	assert.Equal(infos[1].Name, "b")
+	assert.Equal(infos[1].Recoverings, 2)
+	assert.Equal(infos[1].LastError, "ouch")
+	assert.Equal(infos[2].Name, "c")
+
+	assert.Nil(la.Stop())
+	assert.Length(loop.Loops(), 2)
+
+	rec := httptest.NewRecorder()
+	loop.NewRegistryHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/loops", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	assert.Equal(rec.Code, http.StatusOK)
+	assert.Length(lines, 3)
+	assert.Match(lines[0], `^NAME +STATUS +STARTED +RECOVERINGS +LAST ERROR$`)
+	assert.Match(lines[1], `^b +running +\S+ +2 +ouch$`)
+	assert.Match(lines[2], `^c +running +\S+ +0\s*$`)
+
+	assert.Nil(loop.StopAll())
+	assert.Length(loop.Loops(), 0)
+	assert.Equal(stops, []string{"a", "c", "b"}, "stopped in reverse order")
+	status, _ := lb.Error()
+	assert.Equal(status, loop.Stopped)
+}
+
+// Test stopping a loop with a timeout.
+func TestStopTimeout(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	done := false
+	l := loop.Go(generateSimpleBackend(&done))
+
+	assert.Nil(l.(loop.TimeoutLoop).StopTimeout(longDelay), "no error after stop in time")
+	assert.True(done, "backend has done")
+
+	release := make(chan struct{})
+	defer close(release)
+	var stack bytes.Buffer
+	l = loop.Go(generateStuckBackend(release), loop.WithName("stuck"), loop.WithStackDump(&stack))
+	start := time.Now()
+	err := l.(loop.TimeoutLoop).StopTimeout(shortDelay)
+
+	assert.True(loop.IsStopTimeoutError(err), "stop timed out")
+	assert.ErrorMatch(err, `.*loop "stuck" did not stop in time.*`)
+	assert.True(time.Since(start) < longDelay, "stop returned after timeout")
+	assert.Match(stack.String(), `(?s)^goroutine \d+ \[.*generateStuckBackend.*`)
+
+	status, _ := l.Error()
+
+	assert.Equal(status, loop.Stopping, "loop is abandoned while stopping")
+}
+
+// Test stopping a loop with a context.
+func TestStopContext(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	l := loop.Go(generateStuckBackend(release))
+
+	go func() {
+		time.Sleep(shortDelay)
+		cancel(errors.New("shutdown"))
+	}()
+	err := l.(loop.TimeoutLoop).StopContext(ctx)
+
+	assert.True(loop.IsStopTimeoutError(err), "stop timed out")
+	assert.ErrorMatch(err, `.*shutdown.*`)
+}
+
+// Test stopping all registered loops with a timeout.
+func TestStopAllTimeout(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	release := make(chan struct{})
+	defer close(release)
+	done := false
+	loop.Go(generateStuckBackend(release), loop.WithName("stuck"))
+	loop.Go(generateSimpleBackend(&done), loop.WithName("fine"))
+
+	err := loop.StopAllTimeout(longDelay)
+
+	assert.True(loop.IsLoopsStuckError(err), "loops are stuck")
+	assert.ErrorMatch(err, `.*loops did not stop in time: stuck$`)
+	assert.True(done, "fine loop has done")
+	assert.Length(loop.Loops(), 1)
+}
+
+// Test finalizing a loop.
+func TestFinalizer(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	finalized := []error{}
+	finalizer := func(err error) error {
+		finalized = append(finalized, err)
+		if err == nil {
+			return errors.New("cleanup failed")
+		}
+		return err
+	}
+
+	done := false
+	l := loop.Go(generateSimpleBackend(&done), loop.WithFinalizer(finalizer))
+	assert.ErrorMatch(l.Stop(), "cleanup failed")
+	status, err := l.Error()
+	assert.Equal(status, loop.Stopped)
+	assert.ErrorMatch(err, "cleanup failed")
+
+	l = loop.Go(generateSimpleBackend(&done), loop.WithFinalizer(finalizer))
+	l.Kill(errors.New("killed"))
+	assert.ErrorMatch(l.Wait(), "killed")
+	assert.Length(finalized, 2)
+}
+
+// Test calling and casting requests to an actor.
+func TestActor(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	sum := 0
+	a := loop.GoActor(func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		sum += n
+		return sum, nil
+	}, 10)
+
+	for i := 1; i <= 5; i++ {
+		assert.Nil(a.Cast(i))
+	}
+	resp, err := a.Call(0)
+	assert.Nil(err)
+	assert.Equal(resp, 15)
+
+	resp, err = a.Call(-1)
+	assert.ErrorMatch(err, "negative")
+	assert.Equal(resp, 0)
+
+	assert.Nil(a.Stop())
+
+	_, err = a.Call(1)
+	assert.True(loop.IsActorStoppedError(err), "actor is stopped")
+	assert.True(loop.IsActorStoppedError(a.Cast(1)), "actor is stopped")
+}
+
+// Test call timeouts and panics of an actor.
+func TestActorTimeoutAndPanic(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	a := loop.GoActor(func(d time.Duration) (string, error) {
+		if d < 0 {
+			panic("negative duration")
+		}
+		time.Sleep(d)
+		return d.String(), nil
+	}, 0)
+
+	resp, err := a.CallTimeout(shortDelay, longDelay)
+	assert.Nil(err)
+	assert.Equal(resp, "20ms")
+
+	_, err = a.CallTimeout(longDelay, shortDelay)
+	assert.True(loop.IsActorTimeoutError(err), "call timed out")
+
+	_, err = a.Call(-1)
+	assert.True(loop.IsActorPanickedError(err), "handler panicked")
+	assert.ErrorMatch(err, ".*negative duration")
+
+	resp, err = a.Call(0)
+	assert.Nil(err, "actor still works")
+	assert.Equal(resp, "0s")
+	assert.Nil(a.Stop())
+}
+
+// Test answering the requests in the mailbox after stopping an actor.
+func TestActorDrain(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	a := loop.GoActor(func(n int) (int, error) {
+		if n == 0 {
+			close(started)
+			<-release
+		}
+		return n, nil
+	}, 10)
+	assert.Nil(a.Cast(0))
+	<-started
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			_, err := a.Call(n)
+			errs <- err
+		}(i)
+	}
+	time.Sleep(shortDelay)
+	go func() {
+		time.Sleep(shortDelay)
+		close(release)
+	}()
+	assert.Nil(a.Stop())
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.True(loop.IsActorStoppedError(err), "request answered with stop error")
+		assert.ErrorMatch(err, `\[LOOP:008\] actor is stopped`)
+	}
+}
+
+// Test the codes of the errors returned by an actor.
+func TestActorErrorCodes(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	a := loop.GoActor(func(d time.Duration) (int, error) {
+		if d < 0 {
+			panic("negative duration")
+		}
+		time.Sleep(d)
+		return 0, nil
+	}, 0)
+
+	_, err := a.CallTimeout(longDelay, shortDelay)
+	assert.True(loop.IsActorTimeoutError(err))
+	assert.ErrorMatch(err, `\[LOOP:009\] actor call timed out: .*`)
+	_, err = a.Call(-1)
+	assert.True(loop.IsActorPanickedError(err))
+	assert.ErrorMatch(err, `\[LOOP:010\] actor handler panicked: negative duration`)
+
+	assert.Nil(a.Stop())
+	_, err = a.Call(0)
+	assert.True(loop.IsActorStoppedError(err))
+	assert.ErrorMatch(err, `\[LOOP:008\] actor is stopped`)
+	err = a.Cast(0)
+	assert.True(loop.IsActorStoppedError(err))
+	assert.ErrorMatch(err, `\[LOOP:008\] actor is stopped`)
+}
+
+// Test running jobs with a pool.
+func TestPool(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	p := loop.GoPool[int](4, 10, loop.DrainJobs)
+	jobs := []loop.Job[int]{}
+	for i := 0; i < 20; i++ {
+		n := i
+		jobs = append(jobs, func() (int, error) {
+			switch {
+			case n == 5:
+				return 0, errors.New("five")
+			case n == 7:
+				panic("seven")
+			}
+			return n * n, nil
+		})
+	}
+
+	rs, err := p.Run(jobs...)
+
+	assert.Nil(err)
+	assert.Length(rs, 20)
+	for i, r := range rs {
+		switch i {
+		case 5:
+			assert.ErrorMatch(r.Err, "five")
+		case 7:
+			assert.True(loop.IsJobPanickedError(r.Err), "job panicked")
+		default:
+			assert.Nil(r.Err)
+			assert.Equal(r.Value, i*i)
+		}
+	}
+	assert.Nil(p.Stop())
+
+	_, err = p.Submit(jobs[0])
+	assert.True(loop.IsPoolStoppedError(err), "pool is stopped")
+}
+
+// Test resizing a pool and its bounded queue.
+func TestPoolResize(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	p := loop.GoPool[int](0, 2, loop.DrainJobs)
+	job := func() (int, error) { return 1, nil }
+
+	_, err := p.TrySubmit(job)
+	assert.Nil(err)
+	rc, err := p.TrySubmit(job)
+	assert.Nil(err)
+	_, err = p.TrySubmit(job)
+	assert.True(loop.IsQueueFullError(err), "queue is full")
+	assert.Equal(p.Pending(), 2)
+
+	assert.Nil(p.Resize(3))
+	assert.Equal(p.Workers(), 3)
+	assert.Equal((<-rc).Value, 1)
+
+	assert.Nil(p.Resize(1))
+	assert.Equal(p.Workers(), 1)
+	rs, err := p.Run(job, job, job)
+	assert.Nil(err)
+	assert.Length(rs, 3)
+
+	assert.Nil(p.Stop())
+	assert.Nil(p.Wait())
+	assert.True(loop.IsPoolStoppedError(p.Resize(2)), "pool is stopped")
+}
+
+// Test the policies for pending jobs when stopping a pool.
+func TestPoolStopPolicies(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	for _, policy := range []int{loop.DrainJobs, loop.AbandonJobs} {
+		p := loop.GoPool[int](1, 10, policy)
+		started := make(chan struct{})
+		release := make(chan struct{})
+		first, err := p.Submit(func() (int, error) {
+			close(started)
+			<-release
+			return 0, nil
+		})
+		assert.Nil(err)
+		<-started
+		rcs := []<-chan *loop.Result[int]{}
+		for i := 1; i <= 5; i++ {
+			n := i
+			rc, err := p.Submit(func() (int, error) { return n, nil })
+			assert.Nil(err)
+			rcs = append(rcs, rc)
+		}
+		go func() {
+			time.Sleep(shortDelay)
+			close(release)
+		}()
+
+		assert.Nil(p.Stop())
+		assert.Nil((<-first).Err, "running job is finished")
+		for i, rc := range rcs {
+			r := <-rc
+			if policy == loop.DrainJobs {
+				assert.Nil(r.Err, "pending job is drained")
+				assert.Equal(r.Value, i+1)
+			} else {
+				assert.True(loop.IsPoolStoppedError(r.Err), "pending job is abandoned")
+			}
+		}
+	}
+}
+
+// Test draining the pending jobs with all workers while
+// the pool can still be queried.
+func TestPoolDrain(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	p := loop.GoPool[int](2, 10, loop.DrainJobs)
+	started := make(chan struct{}, 4)
+	release := make(chan struct{}, 4)
+	job := func() (int, error) {
+		started <- struct{}{}
+		<-release
+		return 1, nil
+	}
+	rcs := []<-chan *loop.Result[int]{}
+	for i := 0; i < 4; i++ {
+		rc, err := p.Submit(job)
+		assert.Nil(err)
+		rcs = append(rcs, rc)
+	}
+	<-started
+	<-started
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- p.Stop()
+	}()
+
+	// Querying and resizing don't block while draining.
+	workers := func() int {
+		wc := make(chan int, 1)
+		go func() { wc <- p.Workers() }()
+		select {
+		case n := <-wc:
+			return n
+		case <-time.After(longDelay):
+			return -1
+		}
+	}
+	n := workers()
+	for i := 0; n > 0 && i < 10; i++ {
+		time.Sleep(shortDelay)
+		n = workers()
+	}
+	assert.Equal(n, 0, "workers are signalled without blocking the pool")
+	assert.True(loop.IsPoolStoppedError(p.Resize(3)), "pool is stopping")
+
+	// Both workers drain the pending jobs.
+	release <- struct{}{}
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(veryLongDelay):
+			assert.True(false, "pending jobs drained in parallel")
+		}
+	}
+	release <- struct{}{}
+	release <- struct{}{}
+	assert.Nil(<-stopped)
+	for _, rc := range rcs {
+		assert.Equal((<-rc).Value, 1)
+	}
+}
+
+// Test the codes of the errors returned by a pool.
+func TestPoolErrorCodes(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	p := loop.GoPool[int](0, 1, loop.DrainJobs)
+	job := func() (int, error) { panic("x") }
+
+	rc, err := p.TrySubmit(job)
+	assert.Nil(err)
+	_, err = p.TrySubmit(job)
+	assert.True(loop.IsQueueFullError(err))
+	assert.ErrorMatch(err, `\[LOOP:012\] job queue of pool is full`)
+	assert.Nil(p.Resize(1))
+	r := <-rc
+	assert.True(loop.IsJobPanickedError(r.Err))
+	assert.ErrorMatch(r.Err, `\[LOOP:013\] job panicked: x`)
+
+	assert.Nil(p.Stop())
+	_, err = p.Submit(job)
+	assert.True(loop.IsPoolStoppedError(err))
+	assert.ErrorMatch(err, `\[LOOP:011\] pool is stopped`)
+	err = p.Resize(2)
+	assert.True(loop.IsPoolStoppedError(err))
+	assert.ErrorMatch(err, `\[LOOP:011\] pool is stopped`)
+}
+
+// Test a ticker with fixed rate and fixed delay. Each tick
+// takes half of the interval.
+func TestTicker(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	start := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		fixedDelay bool
+		offsets    []time.Duration
+	}{
+		{false, []time.Duration{60, 120, 180, 240, 300}},
+		{true, []time.Duration{60, 150, 240, 330, 420}},
+	}
+	for _, test := range tests {
+		c := clock.NewFake(start)
+		ticks := make(chan time.Time, 10)
+		opts := []loop.TickerOption{loop.WithLoopOptions(loop.WithClock(c))}
+		if test.fixedDelay {
+			opts = append(opts, loop.WithFixedDelay())
+		}
+		tkr := loop.GoTicker(time.Minute, func(t time.Time) error {
+			ticks <- t
+			c.Advance(30 * time.Second)
+			return nil
+		}, opts...)
+
+		for _, offset := range test.offsets {
+			tick := start.Add(offset * time.Second)
+			c.BlockUntil(1)
+			c.Advance(tick.Sub(c.Now()))
+			assert.Equal(<-ticks, tick)
+		}
+		assert.Nil(tkr.Stop())
+	}
+}
+
+// Test the rejection of invalid intervals.
+func TestTickerInvalidInterval(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	tf := func(t time.Time) error { return nil }
+	for _, interval := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				err, ok := recover().(error)
+				assert.True(ok, "ticker panics with error")
+				assert.True(loop.IsInvalidIntervalError(err))
+				assert.ErrorMatch(err, `\[LOOP:019\] invalid ticker interval .*`)
+			}()
+			loop.GoTicker(interval, tf)
+		}()
+	}
+
+	tkr := loop.GoTicker(time.Hour, tf)
+	assert.True(loop.IsInvalidIntervalError(tkr.SetInterval(0)))
+	assert.Nil(tkr.Stop())
+}
+
+// Test pausing and resuming a ticker.
+func TestTickerPause(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	ticks := make(chan struct{}, 1000)
+	tkr := loop.GoTicker(shortDelay/2, func(t time.Time) error {
+		ticks <- struct{}{}
+		return nil
+	})
+
+	time.Sleep(longDelay)
+	assert.Nil(tkr.Pause())
+	time.Sleep(shortDelay)
+	drainTicks(ticks)
+	time.Sleep(longDelay)
+	assert.Equal(drainTicks(ticks), 0, "no ticks while paused")
+
+	assert.Nil(tkr.Resume())
+	time.Sleep(longDelay)
+	assert.True(drainTicks(ticks) > 0, "ticks after resume")
+	assert.Nil(tkr.Stop())
+}
+
+// Test a ticker with a fake clock.
+func TestTickerClock(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	start := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+	ticks := make(chan time.Time, 10)
+	tkr := loop.GoTicker(time.Minute, func(t time.Time) error {
+		ticks <- t
+		return nil
+	}, loop.WithLoopOptions(loop.WithClock(c)))
+
+	for i := 1; i <= 3; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Minute)
+		assert.Equal(<-ticks, start.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Nil(tkr.Stop())
+}
+
+// Test catching up or skipping of missed ticks.
+func TestTickerOverlaps(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	for _, skip := range []bool{false, true} {
+		count := 0
+		opts := []loop.TickerOption{loop.WithImmediateStart()}
+		if skip {
+			opts = append(opts, loop.WithSkipOverlaps())
+		}
+		tkr := loop.GoTicker(shortDelay, func(t time.Time) error {
+			count++
+			if count == 1 {
+				// Miss the ticks at 20, 40, and 60 milliseconds.
+				time.Sleep(3*shortDelay + shortDelay/2)
+			}
+			return nil
+		}, opts...)
+
+		time.Sleep(4*shortDelay + shortDelay/4)
+		assert.Nil(tkr.Stop())
+
+		if skip {
+			// Ticks at 0 and 80 milliseconds.
+			assert.Equal(count, 2)
+		} else {
+			// Ticks at 0, 70 (three times), and 80 milliseconds.
+			assert.Equal(count, 5)
+		}
+	}
+}
+
+// Test changing the interval and stopping a ticker with an error.
+func TestTickerIntervalAndError(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	count := 0
+	tkr := loop.GoTicker(time.Hour, func(t time.Time) error {
+		count++
+		if count == 3 {
+			return errors.New("three")
+		}
+		return nil
+	}, loop.WithJitter(0.1), loop.WithLoopOptions(loop.WithName("ticker")))
+
+	assert.Nil(tkr.SetInterval(shortDelay))
+	assert.ErrorMatch(tkr.Wait(), "three")
+	assert.Equal(count, 3)
+	assert.True(loop.IsTickerStoppedError(tkr.SetInterval(time.Second)), "ticker is stopped")
+}
+
+// Test a group with a failing member.
+func TestGroupFailure(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	g := loop.NewGroup()
+	assert.Nil(g.Go("a", generateSimpleBackend(new(bool))))
+	assert.Nil(g.Go("b", generateErrorBackend(new(bool))))
+	assert.Nil(g.Go("c", func(l loop.Loop) error { return nil }))
+	assert.Nil(g.Go("d", generateSimpleBackend(new(bool))))
+
+	err := g.Wait()
+
+	assert.True(loop.IsMemberFailedError(err), "member failed")
+	assert.ErrorMatch(err, `.*group member "b" failed: timed out`)
+	assert.True(loop.IsGroupFailedError(g.Go("e", generateSimpleBackend(new(bool)))), "group failed")
+
+	rs := g.Results()
+	assert.Length(rs, 4)
+	for _, r := range rs {
+		assert.Equal(r.Status, loop.Stopped)
+		switch r.Name {
+		case "a", "d":
+			assert.True(loop.IsGroupKilledError(r.Err), "member killed")
+		case "b":
+			assert.ErrorMatch(r.Err, "timed out")
+		case "c":
+			assert.Nil(r.Err, "member ended before")
+		}
+	}
+}
+
+// Test stopping a group.
+func TestGroupStop(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	g := loop.NewGroup()
+	for _, name := range []string{"a", "b", "c"} {
+		assert.Nil(g.Go(name, generateSimpleBackend(new(bool))))
+	}
+
+	assert.Nil(g.Stop())
+	for _, r := range g.Results() {
+		assert.Equal(r.Status, loop.Stopped)
+		assert.Nil(r.Err)
+	}
+}
+
+// Test the one-for-one restart strategy of a supervisor.
+func TestSupervisorOneForOne(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	starts := newStartCounter()
+	s := loop.GoSupervisor(loop.OneForOne, 5, time.Second)
+
+	assert.Nil(s.Go("a", starts.startFunc("a", 0)))
+	assert.Nil(s.Go("b", starts.startFunc("b", shortDelay)))
+	assert.True(loop.IsDuplicateChildError(s.Go("a", starts.startFunc("a", 0))))
+
+	time.Sleep(longDelay)
+
+	assert.Nil(s.Stop(), "no error after stop")
+	assert.Equal(starts.get("a"), 1, "child a started once")
+	assert.True(starts.get("b") > 1, "child b restarted")
+	assert.Equal(starts.stopped(), []string{"b", "a"}, "stopped in reverse order")
+	assert.True(loop.IsSupervisorStoppedError(s.Go("c", starts.startFunc("c", 0))))
+}
+
+// Test pausing and resuming a supervisor.
+func TestSupervisorPause(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	starts := newStartCounter()
+	ticks := make(chan struct{}, 1000)
+	s := loop.GoSupervisor(loop.OneForOne, -1, time.Second)
+
+	assert.Nil(s.GoLoop("a", generatePausableBackend(ticks)))
+	assert.Nil(s.Go("b", starts.startFunc("b", shortDelay)))
+
+	assert.Nil(s.Pause())
+	status, _ := s.Error()
+	assert.Equal(status, loop.Paused)
+	time.Sleep(shortDelay / 2)
+	drainTicks(ticks)
+	time.Sleep(longDelay)
+	assert.Equal(drainTicks(ticks), 0, "no ticks of a while paused")
+	assert.Equal(starts.get("b"), 1, "b not restarted while paused")
+
+	assert.Nil(s.Resume())
+	time.Sleep(longDelay)
+	assert.True(drainTicks(ticks) > 0, "ticks of a after resume")
+	assert.True(starts.get("b") > 1, "b restarted after resume")
+
+	assert.Nil(s.Stop())
+	assert.True(loop.IsSupervisorStoppedError(s.Pause()))
+}
+
+// Test the one-for-all restart strategy of a supervisor.
+func TestSupervisorOneForAll(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	starts := newStartCounter()
+	s := loop.GoSupervisor(loop.OneForAll, 1, time.Second)
+
+	assert.Nil(s.Go("a", starts.startFunc("a", 0)))
+	assert.Nil(s.Go("b", starts.startFunc("b", veryLongDelay)))
+	assert.Nil(s.Go("c", starts.startFunc("c", 0)))
+
+	time.Sleep(veryLongDelay + longDelay)
+
+	assert.Nil(s.Stop(), "no error after stop")
+	assert.Equal(starts.get("a"), 2, "child a restarted")
+	assert.Equal(starts.get("b"), 2, "child b restarted")
+	assert.Equal(starts.get("c"), 2, "child c restarted")
+	assert.Equal(starts.stopped(), []string{"c", "a", "c", "b", "a"}, "stopped in reverse order")
+}
+
+// Test the rest-for-one restart strategy of a supervisor.
+func TestSupervisorRestForOne(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	starts := newStartCounter()
+	s := loop.GoSupervisor(loop.RestForOne, 1, time.Second)
+
+	assert.Nil(s.Go("a", starts.startFunc("a", 0)))
+	assert.Nil(s.Go("b", starts.startFunc("b", veryLongDelay)))
+	assert.Nil(s.Go("c", starts.startFunc("c", 0)))
+
+	time.Sleep(veryLongDelay + longDelay)
+
+	assert.Nil(s.Stop(), "no error after stop")
+	assert.Equal(starts.get("a"), 1, "child a not restarted")
+	assert.Equal(starts.get("b"), 2, "child b restarted")
+	assert.Equal(starts.get("c"), 2, "child c restarted")
+	assert.Equal(starts.stopped(), []string{"c", "c", "b", "a"}, "stopped in reverse order")
+}
+
+// Test the restart intensity of nested supervisors.
+func TestSupervisorIntensity(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	starts := newStartCounter()
+	root := loop.GoSupervisor(loop.OneForOne, 1, time.Second)
+	err := root.Go("sub", func() (loop.Supervisable, error) {
+		starts.inc("sub")
+		sub := loop.GoSupervisor(loop.OneForOne, 3, time.Second)
+		if err := sub.Go("a", starts.startFunc("a", shortDelay)); err != nil {
+			return nil, err
+		}
+		return sub, nil
+	})
+	assert.Nil(err)
+
+	err = root.Wait()
+
+	assert.True(loop.IsTooManyRestartsError(err), "root restarted sub too often")
+	assert.Equal(starts.get("sub"), 2, "sub restarted once")
+	assert.Equal(starts.get("a"), 8, "child a started 4 times per sub")
+}
+
+// Test a failing start of a child.
+func TestSupervisorStartFailed(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	s := loop.GoSupervisor(loop.OneForOne, 5, time.Second)
+	err := s.Go("fail", func() (loop.Supervisable, error) {
+		return nil, errors.New("ouch")
+	})
+
+	assert.True(loop.IsStartFailedError(err), "start failed")
+	assert.Nil(s.Stop(), "no error after stop")
+}
+
 //--------------------
 // EXAMPLES
 //--------------------
@@ -182,6 +1267,26 @@ func ExampleRecoverFunc() {
 	loop.GoRecoverable(loopFunc, recoverFunc)
 }
 
+func ExampleGoContext() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	loopFunc := func(l loop.Loop) error {
+		for {
+			select {
+			case <-l.ShallStop():
+				return nil
+			case <-time.After(100 * time.Millisecond):
+				// Pass the context to the work of the loop.
+				doWork(l.(loop.ContextLoop).Context())
+			}
+		}
+	}
+	l := loop.GoContext(ctx, loopFunc)
+	l.Wait()
+}
+
+func doWork(ctx context.Context) {}
+
 //--------------------
 // HELPERS
 //--------------------
@@ -198,6 +1303,64 @@ func generateSimpleBackend(done *bool) loop.LoopFunc {
 	}
 }
 
+// generatePausableBackend returns a backend sending ticks
+// while it is not paused.
+func generatePausableBackend(ticks chan struct{}) loop.LoopFunc {
+	return func(l loop.Loop) error {
+		pl := l.(loop.PausableLoop)
+		for {
+			select {
+			case <-l.ShallStop():
+				return nil
+			case <-pl.ShallPause():
+				select {
+				case <-l.ShallStop():
+					return nil
+				case <-pl.ShallResume():
+				}
+			case <-time.After(shortDelay / 4):
+				ticks <- struct{}{}
+			}
+		}
+	}
+}
+
+// drainTicks empties the channel and returns the number of ticks.
+func drainTicks(ticks chan struct{}) int {
+	n := 0
+	for {
+		select {
+		case <-ticks:
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func generateStuckBackend(release chan struct{}) loop.LoopFunc {
+	return func(l loop.Loop) error {
+		<-release
+		return nil
+	}
+}
+
+// generateFailingBackend returns a backend failing the first times
+// with an error or a panic.
+func generateFailingBackend(count *int, fails int, panics bool) loop.LoopFunc {
+	return func(l loop.Loop) error {
+		*count++
+		if *count <= fails {
+			if panics {
+				panic("failed")
+			}
+			return errors.New("failed")
+		}
+		<-l.ShallStop()
+		return nil
+	}
+}
+
 func generateErrorBackend(done *bool) loop.LoopFunc {
 	return func(l loop.Loop) error {
 		defer func() { t := true; *done = t }()
@@ -279,4 +1442,56 @@ func ignorePanics(rs loop.Recoverings) (loop.Recoverings, error) {
 	return nil, nil
 }
 
+// startCounter counts the starts and stops of supervised children.
+type startCounter struct {
+	mux    sync.Mutex
+	starts map[string]int
+	stops  []string
+}
+
+func newStartCounter() *startCounter {
+	return &startCounter{starts: make(map[string]int)}
+}
+
+func (sc *startCounter) inc(id string) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.starts[id]++
+}
+
+func (sc *startCounter) get(id string) int {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	return sc.starts[id]
+}
+
+func (sc *startCounter) stopped() []string {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	return append([]string{}, sc.stops...)
+}
+
+// startFunc returns a start function for a loop ending with an
+// error after the delay, or running until stopped with a zero delay.
+func (sc *startCounter) startFunc(id string, delay time.Duration) loop.StartFunc {
+	return func() (loop.Supervisable, error) {
+		sc.inc(id)
+		return loop.Go(func(l loop.Loop) error {
+			var timeout <-chan time.Time
+			if delay > 0 {
+				timeout = time.After(delay)
+			}
+			select {
+			case <-l.ShallStop():
+				sc.mux.Lock()
+				sc.stops = append(sc.stops, id)
+				sc.mux.Unlock()
+				return nil
+			case <-timeout:
+				return errors.New("timed out")
+			}
+		}), nil
+	}
+}
+
 // EOF
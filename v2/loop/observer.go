@@ -0,0 +1,116 @@
+// Tideland Go Application Support - Loop - Observer
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+)
+
+//--------------------
+// EVENTS
+//--------------------
+
+// Kinds of the lifecycle events of a loop.
+const (
+	EventStarted = iota
+	EventRecovered
+	EventStopping
+	EventStopped
+	EventPaused
+	EventResumed
+)
+
+// eventKinds contains the names of the event kinds.
+var eventKinds = map[int]string{
+	EventStarted:   "started",
+	EventRecovered: "recovered",
+	EventStopping:  "stopping",
+	EventStopped:   "stopped",
+	EventPaused:    "paused",
+	EventResumed:   "resumed",
+}
+
+// Event describes a change in the lifecycle of a loop. The reason
+// is the recovered value in case of a recovering and the error of
+// the loop when stopping or stopped.
+type Event struct {
+	Kind   int
+	Time   time.Time
+	Reason interface{}
+}
+
+// String returns the name of the event kind.
+func (e *Event) String() string {
+	return eventKinds[e.Kind]
+}
+
+//--------------------
+// OBSERVERS
+//--------------------
+
+// Observer is notified about the lifecycle events of a loop. The
+// events are passed in the order they happen. An observer must not
+// block and must not stop or kill the observed loop.
+type Observer func(e *Event)
+
+// WithObserver adds an observer to a loop.
+func WithObserver(o Observer) Option {
+	return func(l *loop) {
+		l.observers = append(l.observers, o)
+	}
+}
+
+// WithEvents lets a loop send its lifecycle events to the channel.
+// Sending does not block, so a buffered channel is recommended.
+func WithEvents(ec chan<- *Event) Option {
+	return WithObserver(func(e *Event) {
+		select {
+		case ec <- e:
+		default:
+		}
+	})
+}
+
+// notify passes an event to the observers.
+func (l *loop) notify(kind int, reason interface{}) {
+	if len(l.observers) == 0 {
+		return
+	}
+	e := &Event{
+		Kind:   kind,
+		Time:   l.clock.Now(),
+		Reason: reason,
+	}
+	for _, o := range l.observers {
+		o(e)
+	}
+}
+
+// notifyLocked passes an event to the observers while holding the
+// observer lock.
+func (l *loop) notifyLocked(kind int, reason interface{}) {
+	l.obsMux.Lock()
+	defer l.obsMux.Unlock()
+	l.notify(kind, reason)
+}
+
+// notifyUnlocking passes an event to the observers after the loop
+// has been unlocked. Taking the observer lock before keeps the order
+// of the events equal to the order of the state changes.
+func (l *loop) notifyUnlocking(kind int, reason interface{}) {
+	l.obsMux.Lock()
+	l.mux.Unlock()
+	defer l.obsMux.Unlock()
+	l.notify(kind, reason)
+}
+
+// EOF
@@ -0,0 +1,281 @@
+// Tideland Go Application Support - Loop - Pool
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sync"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// JOB
+//--------------------
+
+// Job is a function executed by a worker of a pool.
+type Job[T any] func() (T, error)
+
+// Result contains the value and the error of an executed job.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// poolJob is a queued job with the channel for its result.
+type poolJob[T any] struct {
+	job        Job[T]
+	resultChan chan *Result[T]
+}
+
+// run executes the job and sends the result. A panic is
+// recovered and returned as error.
+func (pj *poolJob[T]) run() {
+	r := &Result[T]{}
+	func() {
+		defer func() {
+			if reason := recover(); reason != nil {
+				r.Err = errors.New(ErrJobPanicked, errorMessages, reason)
+			}
+		}()
+		r.Value, r.Err = pj.job()
+	}()
+	pj.resultChan <- r
+}
+
+// abandon sends the stopped error as result.
+func (pj *poolJob[T]) abandon() {
+	pj.resultChan <- &Result[T]{Err: errors.New(ErrPoolStopped, errorMessages)}
+}
+
+//--------------------
+// POOL
+//--------------------
+
+// Policies for the pending jobs when stopping a pool.
+const (
+	// DrainJobs executes the pending jobs before stopping.
+	DrainJobs = iota
+
+	// AbandonJobs answers the pending jobs with an error.
+	AbandonJobs
+)
+
+// Pool executes the submitted jobs with a number of workers,
+// each running in a loop.
+type Pool[T any] struct {
+	submitMux  sync.RWMutex
+	workersMux sync.Mutex
+	policy     int
+	queue      chan *poolJob[T]
+	workers    []Loop
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+}
+
+// GoPool starts a pool with the number of workers. Up to queueSize
+// jobs are queued before submitting blocks. The policy defines if
+// the pending jobs are drained or abandoned when stopping the pool.
+func GoPool[T any](workers, queueSize, policy int) *Pool[T] {
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &Pool[T]{
+		policy:   policy,
+		queue:    make(chan *poolJob[T], queueSize),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	p.Resize(workers)
+	return p
+}
+
+// Submit queues a job and returns the channel receiving its
+// result. It blocks while the queue is full.
+func (p *Pool[T]) Submit(job Job[T]) (<-chan *Result[T], error) {
+	return p.submit(job, true)
+}
+
+// TrySubmit queues a job like Submit() but returns an error
+// instead of blocking if the queue is full.
+func (p *Pool[T]) TrySubmit(job Job[T]) (<-chan *Result[T], error) {
+	return p.submit(job, false)
+}
+
+// Run submits all jobs, waits until they are done, and returns
+// their results in the order of the jobs.
+func (p *Pool[T]) Run(jobs ...Job[T]) ([]*Result[T], error) {
+	rcs := []<-chan *Result[T]{}
+	for _, job := range jobs {
+		rc, err := p.Submit(job)
+		if err != nil {
+			return nil, err
+		}
+		rcs = append(rcs, rc)
+	}
+	rs := []*Result[T]{}
+	for _, rc := range rcs {
+		rs = append(rs, <-rc)
+	}
+	return rs, nil
+}
+
+// Resize changes the number of workers. Removed workers finish
+// their current job.
+func (p *Pool[T]) Resize(workers int) error {
+	p.workersMux.Lock()
+	defer p.workersMux.Unlock()
+	select {
+	case <-p.stopChan:
+		return errors.New(ErrPoolStopped, errorMessages)
+	default:
+	}
+	if workers < 0 {
+		workers = 0
+	}
+	for len(p.workers) < workers {
+		p.workers = append(p.workers, Go(p.worker))
+	}
+	for len(p.workers) > workers {
+		last := len(p.workers) - 1
+		p.workers[last].Stop()
+		p.workers = p.workers[:last]
+	}
+	return nil
+}
+
+// Workers returns the number of workers.
+func (p *Pool[T]) Workers() int {
+	p.workersMux.Lock()
+	defer p.workersMux.Unlock()
+	return len(p.workers)
+}
+
+// Pending returns the number of queued jobs.
+func (p *Pool[T]) Pending() int {
+	return len(p.queue)
+}
+
+// Stop stops the pool. Depending on the policy the pending jobs
+// are executed or answered with an error. Further calls wait until
+// the pool is stopped.
+func (p *Pool[T]) Stop() error {
+	p.workersMux.Lock()
+	select {
+	case <-p.stopChan:
+		p.workersMux.Unlock()
+		return p.Wait()
+	default:
+	}
+	close(p.stopChan)
+	// Wait for running submits, no more jobs after that.
+	p.submitMux.Lock()
+	p.submitMux.Unlock()
+	// Signal all workers first, so that they drain the pending
+	// jobs together without holding the lock.
+	workers := p.workers
+	p.workers = nil
+	for _, w := range workers {
+		w.Kill(nil)
+	}
+	p.workersMux.Unlock()
+	for _, w := range workers {
+		w.Wait()
+	}
+	for {
+		select {
+		case pj := <-p.queue:
+			pj.abandon()
+		default:
+			close(p.doneChan)
+			return nil
+		}
+	}
+}
+
+// Wait blocks the caller until the pool is stopped.
+func (p *Pool[T]) Wait() error {
+	<-p.doneChan
+	return nil
+}
+
+// submit queues a job.
+func (p *Pool[T]) submit(job Job[T], block bool) (<-chan *Result[T], error) {
+	pj := &poolJob[T]{
+		job:        job,
+		resultChan: make(chan *Result[T], 1),
+	}
+	p.submitMux.RLock()
+	defer p.submitMux.RUnlock()
+	select {
+	case <-p.stopChan:
+		return nil, errors.New(ErrPoolStopped, errorMessages)
+	default:
+	}
+	if !block {
+		select {
+		case p.queue <- pj:
+			return pj.resultChan, nil
+		default:
+			return nil, errors.New(ErrQueueFull, errorMessages)
+		}
+	}
+	select {
+	case p.queue <- pj:
+		return pj.resultChan, nil
+	case <-p.stopChan:
+		return nil, errors.New(ErrPoolStopped, errorMessages)
+	}
+}
+
+// worker is the loop function of one worker.
+func (p *Pool[T]) worker(l Loop) error {
+	for {
+		// Stopping has priority over the queue.
+		select {
+		case <-l.ShallStop():
+			p.drain()
+			return nil
+		default:
+		}
+		select {
+		case <-l.ShallStop():
+			p.drain()
+			return nil
+		case pj := <-p.queue:
+			pj.run()
+		}
+	}
+}
+
+// drain executes the pending jobs if the pool is stopping
+// and the policy is to drain them.
+func (p *Pool[T]) drain() {
+	select {
+	case <-p.stopChan:
+	default:
+		// Only resized.
+		return
+	}
+	if p.policy != DrainJobs {
+		return
+	}
+	for {
+		select {
+		case pj := <-p.queue:
+			pj.run()
+		default:
+			return
+		}
+	}
+}
+
+// EOF
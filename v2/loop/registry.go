@@ -0,0 +1,217 @@
+// Tideland Go Application Support - Loop - Registry
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// INFO
+//--------------------
+
+// statusNames contains the names of the loop status.
+var statusNames = map[int]string{
+	Running:  "running",
+	Stopping: "stopping",
+	Stopped:  "stopped",
+	Paused:   "paused",
+}
+
+// Info describes a named loop in the registry.
+type Info struct {
+	Name        string
+	Status      int
+	Started     time.Time
+	Recoverings int
+	LastError   interface{}
+}
+
+//--------------------
+// REGISTRY
+//--------------------
+
+// entry is one loop in the registry.
+type entry struct {
+	name        string
+	loop        *loop
+	started     time.Time
+	recoverings int
+	lastError   interface{}
+}
+
+// registry contains all running named loops in start order.
+type registry struct {
+	mux     sync.Mutex
+	entries []*entry
+}
+
+// theRegistry is the one process-wide registry.
+var theRegistry = &registry{}
+
+// WithName names a loop. Named loops are registered from their
+// start until they are stopped, so they can be listed with Loops().
+func WithName(name string) Option {
+	return func(l *loop) {
+		e := &entry{
+			name: name,
+			loop: l,
+		}
+		l.name = name
+		l.observers = append(l.observers, e.observe)
+	}
+}
+
+// observe updates the registry on events of the entry's loop.
+func (e *entry) observe(ev *Event) {
+	theRegistry.mux.Lock()
+	defer theRegistry.mux.Unlock()
+	switch ev.Kind {
+	case EventStarted:
+		e.started = ev.Time
+		theRegistry.entries = append(theRegistry.entries, e)
+	case EventRecovered:
+		e.recoverings++
+		e.lastError = ev.Reason
+	case EventStopping:
+		if ev.Reason != nil {
+			e.lastError = ev.Reason
+		}
+	case EventStopped:
+		for i, re := range theRegistry.entries {
+			if re == e {
+				theRegistry.entries = append(theRegistry.entries[:i], theRegistry.entries[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// snapshot returns a copy of the entries.
+func (r *registry) snapshot() []entry {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	es := make([]entry, len(r.entries))
+	for i, e := range r.entries {
+		es[i] = *e
+	}
+	return es
+}
+
+// Loops returns the infos about the registered loops in start order.
+func Loops() []*Info {
+	infos := []*Info{}
+	for _, e := range theRegistry.snapshot() {
+		status, _ := e.loop.Error()
+		infos = append(infos, &Info{
+			Name:        e.name,
+			Status:      status,
+			Started:     e.started,
+			Recoverings: e.recoverings,
+			LastError:   e.lastError,
+		})
+	}
+	return infos
+}
+
+// StopAll stops the registered loops in reverse start order, e.g.
+// during the shutdown of an application. It returns the first error
+// of a loop.
+func StopAll() error {
+	var first error
+	es := theRegistry.snapshot()
+	for i := len(es) - 1; i >= 0; i-- {
+		if err := es[i].loop.Stop(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// StopAllTimeout stops the registered loops like StopAll() but
+// waits only for the passed duration in total.
+func StopAllTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return StopAllContext(ctx)
+}
+
+// StopAllContext stops the registered loops like StopAll() but
+// waits only until the context is done. The loops not stopped
+// until then are abandoned and reported in the returned error.
+func StopAllContext(ctx context.Context) error {
+	var first error
+	stuck := []string{}
+	es := theRegistry.snapshot()
+	for i := len(es) - 1; i >= 0; i-- {
+		err := es[i].loop.StopContext(ctx)
+		switch {
+		case IsStopTimeoutError(err):
+			stuck = append(stuck, es[i].name)
+		case err != nil && first == nil:
+			first = err
+		}
+	}
+	if len(stuck) > 0 {
+		return errors.New(ErrLoopsStuck, errorMessages, strings.Join(stuck, ", "))
+	}
+	return first
+}
+
+// WriteLoops writes a table of the registered loops to w.
+func WriteLoops(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tSTARTED\tRECOVERINGS\tLAST ERROR")
+	for _, info := range Loops() {
+		lastError := ""
+		if info.LastError != nil {
+			lastError = fmt.Sprintf("%v", info.LastError)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n",
+			info.Name,
+			statusNames[info.Status],
+			info.Started.Format(time.RFC3339),
+			info.Recoverings,
+			lastError)
+	}
+	return tw.Flush()
+}
+
+// registryHandler serves the table of the registered loops.
+type registryHandler struct{}
+
+// NewRegistryHandler returns a handler writing the table of the
+// registered loops as plain text, e.g. for an admin mux.
+func NewRegistryHandler() http.Handler {
+	return registryHandler{}
+}
+
+// ServeHTTP is specified on the http.Handler interface.
+func (rh registryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	WriteLoops(w)
+}
+
+// EOF
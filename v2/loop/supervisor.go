@@ -0,0 +1,369 @@
+// Tideland Go Application Support - Loop - Supervisor
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// SUPERVISABLE
+//--------------------
+
+// Supervisable defines the methods a child of a supervisor has
+// to provide, e.g. a loop, a crontab, a scene, or another supervisor.
+type Supervisable interface {
+	// Stop tells the child to stop working and waits until it is done.
+	Stop() error
+
+	// Wait blocks the caller until the child ended and returns the error.
+	Wait() error
+}
+
+// Pausable is implemented by children which can be paused and
+// resumed together with their supervisor, e.g. a ticker or another
+// supervisor.
+type Pausable interface {
+	// Pause tells the child to suspend its work.
+	Pause() error
+
+	// Resume tells the child to continue its work.
+	Resume() error
+}
+
+// StartFunc starts a child of a supervisor. It is called when the
+// child is added and for each restart.
+type StartFunc func() (Supervisable, error)
+
+// Restart strategies of a supervisor.
+const (
+	// OneForOne restarts only the terminated child.
+	OneForOne = iota
+
+	// OneForAll stops all other children and restarts all.
+	OneForAll
+
+	// RestForOne stops the children started after the terminated
+	// one and restarts them together with it.
+	RestForOne
+)
+
+//--------------------
+// SUPERVISOR
+//--------------------
+
+// child is one supervised child.
+type child struct {
+	id      string
+	start   StartFunc
+	current Supervisable
+}
+
+// termination signals the end of a child.
+type termination struct {
+	child *child
+	sv    Supervisable
+	err   error
+}
+
+// pausing is the request to pause or resume the supervisor.
+type pausing struct {
+	pause    bool
+	respChan chan error
+}
+
+// addition is the request to add a new child.
+type addition struct {
+	child    *child
+	respChan chan error
+}
+
+// Supervisor owns a number of children and restarts them if they
+// terminate. As a supervisor is a Supervisable itself it can be
+// the child of another supervisor to build trees.
+type Supervisor struct {
+	strategy    int
+	intensity   int
+	period      time.Duration
+	children    []*child
+	recoverings Recoverings
+	addChan     chan *addition
+	termChan    chan *termination
+	pauseChan   chan *pausing
+	paused      bool
+	pending     []*termination
+	stopping    <-chan struct{}
+	loop        Loop
+}
+
+// GoSupervisor starts a supervisor with the given restart strategy.
+// Terminated children are restarted regardless of their error. If
+// there are more than intensity restarts during period the supervisor
+// stops all children and ends with an error. This way its own
+// supervisor can decide how to continue. The options are those of
+// the loop running the supervisor.
+func GoSupervisor(strategy, intensity int, period time.Duration, opts ...Option) *Supervisor {
+	s := &Supervisor{
+		strategy:  strategy,
+		intensity: intensity,
+		period:    period,
+		addChan:   make(chan *addition),
+		termChan:  make(chan *termination),
+		pauseChan: make(chan *pausing),
+	}
+	s.loop = Go(s.backendLoop, opts...)
+	return s
+}
+
+// Go adds a child to the supervisor and starts it with the passed
+// function. The ID has to be unique for the supervisor.
+func (s *Supervisor) Go(id string, sf StartFunc) error {
+	a := &addition{
+		child:    &child{id: id, start: sf},
+		respChan: make(chan error, 1),
+	}
+	select {
+	case s.addChan <- a:
+	case <-s.loop.IsStopping():
+		return errors.New(ErrSupervisorStopped, errorMessages)
+	}
+	return <-a.respChan
+}
+
+// GoLoop adds a loop running the loop function as child.
+func (s *Supervisor) GoLoop(id string, lf LoopFunc) error {
+	return s.Go(id, func() (Supervisable, error) {
+		return Go(lf), nil
+	})
+}
+
+// Pause pauses the supervisor and all its pausable children. While
+// paused terminated children are not restarted before the supervisor
+// is resumed. Children added during a pause are paused after their
+// start.
+func (s *Supervisor) Pause() error {
+	return s.pausing(true)
+}
+
+// Resume resumes the supervisor and all its pausable children.
+// Then the children terminated during the pause are restarted.
+func (s *Supervisor) Resume() error {
+	return s.pausing(false)
+}
+
+// pausing sends a pause or resume request to the backend.
+func (s *Supervisor) pausing(pause bool) error {
+	p := &pausing{
+		pause:    pause,
+		respChan: make(chan error, 1),
+	}
+	select {
+	case s.pauseChan <- p:
+	case <-s.loop.IsStopping():
+		return errors.New(ErrSupervisorStopped, errorMessages)
+	}
+	return <-p.respChan
+}
+
+// Stop stops all children in the reverse order of their start
+// and then the supervisor itself.
+func (s *Supervisor) Stop() error {
+	return s.loop.Stop()
+}
+
+// Wait blocks the caller until the supervisor ended and returns
+// the error.
+func (s *Supervisor) Wait() error {
+	return s.loop.Wait()
+}
+
+// Error returns the current status and error of the supervisor.
+func (s *Supervisor) Error() (int, error) {
+	return s.loop.Error()
+}
+
+// backendLoop runs the supervisor.
+func (s *Supervisor) backendLoop(l Loop) error {
+	s.stopping = l.IsStopping()
+	defer s.stopChildren(0)
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case a := <-s.addChan:
+			a.respChan <- s.add(a.child)
+		case p := <-s.pauseChan:
+			if p.pause {
+				p.respChan <- s.pause(l)
+				continue
+			}
+			err := s.resume(l)
+			p.respChan <- err
+			if err != nil {
+				return err
+			}
+		case t := <-s.termChan:
+			if t.sv != t.child.current {
+				// Child has been stopped by the supervisor.
+				continue
+			}
+			if s.paused {
+				s.pending = append(s.pending, t)
+				continue
+			}
+			if err := s.restart(t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// pause pauses the supervisor loop and the pausable children.
+func (s *Supervisor) pause(l Loop) error {
+	if s.paused {
+		return nil
+	}
+	if err := l.(PausableLoop).Pause(); err != nil {
+		return err
+	}
+	s.paused = true
+	for _, c := range s.children {
+		pauseChild(c.current)
+	}
+	return nil
+}
+
+// resume resumes the supervisor loop and the pausable children
+// and restarts the children terminated in the meantime.
+func (s *Supervisor) resume(l Loop) error {
+	if !s.paused {
+		return nil
+	}
+	if err := l.(PausableLoop).Resume(); err != nil {
+		return err
+	}
+	s.paused = false
+	for _, c := range s.children {
+		if p, ok := c.current.(Pausable); ok {
+			p.Resume()
+		}
+	}
+	pending := s.pending
+	s.pending = nil
+	for _, t := range pending {
+		if t.sv != t.child.current {
+			continue
+		}
+		if err := s.restart(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pauseChild pauses a child if it is pausable.
+func pauseChild(sv Supervisable) {
+	if p, ok := sv.(Pausable); ok {
+		p.Pause()
+	}
+}
+
+// add adds and starts a new child.
+func (s *Supervisor) add(c *child) error {
+	for _, sc := range s.children {
+		if sc.id == c.id {
+			return errors.New(ErrDuplicateChild, errorMessages, c.id)
+		}
+	}
+	if err := s.startChild(c); err != nil {
+		return err
+	}
+	s.children = append(s.children, c)
+	if s.paused {
+		pauseChild(c.current)
+	}
+	return nil
+}
+
+// restart handles the termination of a child depending on
+// the strategy.
+func (s *Supervisor) restart(t *termination) error {
+	t.child.current = nil
+	s.recoverings = append(s.recoverings, &Recovering{Time: clockOf(s.loop).Now(), Reason: t.err})
+	if s.intensity >= 0 && s.recoverings.Frequency(s.intensity+1, s.period) {
+		return errors.New(ErrTooManyRestarts, errorMessages, t.child.id, t.err)
+	}
+	s.recoverings = s.recoverings.Trim(s.intensity + 1)
+	first := s.index(t.child)
+	switch s.strategy {
+	case OneForAll:
+		first = 0
+		s.stopChildren(first)
+	case RestForOne:
+		s.stopChildren(first + 1)
+	default:
+		return s.startChild(t.child)
+	}
+	for _, c := range s.children[first:] {
+		if err := s.startChild(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startChild starts a child and watches its termination.
+func (s *Supervisor) startChild(c *child) error {
+	sv, err := c.start()
+	if err != nil {
+		return errors.Annotate(err, ErrStartFailed, errorMessages, c.id)
+	}
+	c.current = sv
+	go s.watch(c, sv)
+	return nil
+}
+
+// watch waits for the termination of a child and reports it.
+func (s *Supervisor) watch(c *child, sv Supervisable) {
+	err := sv.Wait()
+	select {
+	case s.termChan <- &termination{c, sv, err}:
+	case <-s.stopping:
+	}
+}
+
+// stopChildren stops the running children starting at
+// the passed index in reverse order.
+func (s *Supervisor) stopChildren(first int) {
+	for i := len(s.children) - 1; i >= first; i-- {
+		c := s.children[i]
+		if c.current != nil {
+			sv := c.current
+			c.current = nil
+			sv.Stop()
+		}
+	}
+}
+
+// index returns the index of the child.
+func (s *Supervisor) index(c *child) int {
+	for i, sc := range s.children {
+		if sc == c {
+			return i
+		}
+	}
+	return len(s.children)
+}
+
+// EOF
@@ -0,0 +1,237 @@
+// Tideland Go Application Support - Loop - Ticker
+//
+// Copyright (C) 2013-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loop
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/tideland/goas/v1/clock"
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// TICKER
+//--------------------
+
+// TickFunc is called periodically by a ticker with the time of the
+// tick. Returning an error stops the ticker.
+type TickFunc func(t time.Time) error
+
+// TickerOption allows to configure a ticker when starting it.
+type TickerOption func(t *Ticker)
+
+// WithFixedDelay lets the ticker wait the interval after the end of
+// each execution instead of executing at a fixed rate.
+func WithFixedDelay() TickerOption {
+	return func(t *Ticker) {
+		t.fixedDelay = true
+	}
+}
+
+// WithJitter delays each execution randomly by up to the fraction
+// of the interval. The schedule itself does not drift.
+func WithJitter(jitter float64) TickerOption {
+	return func(t *Ticker) {
+		t.jitter = jitter
+	}
+}
+
+// WithSkipOverlaps lets a fixed rate ticker skip the ticks missed
+// during a long execution instead of catching up on them.
+func WithSkipOverlaps() TickerOption {
+	return func(t *Ticker) {
+		t.skipOverlaps = true
+	}
+}
+
+// WithImmediateStart lets the ticker execute the first time
+// directly after starting instead of after the first interval.
+func WithImmediateStart() TickerOption {
+	return func(t *Ticker) {
+		t.immediate = true
+	}
+}
+
+// WithLoopOptions passes options to the loop running the ticker.
+func WithLoopOptions(opts ...Option) TickerOption {
+	return func(t *Ticker) {
+		t.loopOptions = append(t.loopOptions, opts...)
+	}
+}
+
+// Ticker calls a function periodically in a loop. By default it
+// executes at a fixed rate. Executions never overlap, ticks missed
+// during a long execution are caught up directly after it.
+type Ticker struct {
+	tickFunc     TickFunc
+	interval     time.Duration
+	fixedDelay   bool
+	jitter       float64
+	skipOverlaps bool
+	immediate    bool
+	loopOptions  []Option
+	intervalChan chan time.Duration
+	clock        clock.Clock
+	loop         PausableLoop
+}
+
+// GoTicker starts a ticker calling the function with the interval.
+// Like time.NewTicker it panics if the interval is not positive.
+func GoTicker(interval time.Duration, tf TickFunc, opts ...TickerOption) *Ticker {
+	if interval <= 0 {
+		panic(errors.New(ErrInvalidInterval, errorMessages, interval))
+	}
+	t := &Ticker{
+		tickFunc:     tf,
+		interval:     interval,
+		intervalChan: make(chan time.Duration),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.loop = Go(t.backendLoop, t.loopOptions...).(PausableLoop)
+	return t
+}
+
+// SetInterval changes the interval of the ticker. The next tick is
+// scheduled based on the last one and the new interval. The
+// interval has to be positive.
+func (t *Ticker) SetInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New(ErrInvalidInterval, errorMessages, interval)
+	}
+	select {
+	case t.intervalChan <- interval:
+		return nil
+	case <-t.loop.IsStopping():
+		return errors.New(ErrTickerStopped, errorMessages)
+	}
+}
+
+// Pause suspends the ticks until the ticker is resumed.
+func (t *Ticker) Pause() error {
+	return t.loop.Pause()
+}
+
+// Resume continues a paused ticker. Ticks missed during the
+// pause are dropped, the next one follows after the interval.
+func (t *Ticker) Resume() error {
+	return t.loop.Resume()
+}
+
+// Stop stops the ticker.
+func (t *Ticker) Stop() error {
+	return t.loop.Stop()
+}
+
+// Wait blocks the caller until the ticker ended and returns the error.
+func (t *Ticker) Wait() error {
+	return t.loop.Wait()
+}
+
+// Error returns the current status and error of the ticker.
+func (t *Ticker) Error() (int, error) {
+	return t.loop.Error()
+}
+
+// backendLoop runs the ticker. The clock is the one of its
+// loop, set with WithLoopOptions(WithClock(c)).
+func (t *Ticker) backendLoop(l Loop) error {
+	pl := l.(PausableLoop)
+	t.clock = clockOf(l)
+	next := t.clock.Now()
+	if !t.immediate {
+		next = next.Add(t.interval)
+	}
+	timer := t.clock.NewTimer(t.wait(next))
+	defer timer.Stop()
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case interval := <-t.intervalChan:
+			next = next.Add(interval - t.interval)
+			t.interval = interval
+			if !timer.Stop() {
+				select {
+				case <-timer.C():
+				default:
+				}
+			}
+			timer.Reset(t.wait(next))
+		case <-pl.ShallPause():
+			if !timer.Stop() {
+				select {
+				case <-timer.C():
+				default:
+				}
+			}
+			if !t.pause(pl) {
+				return nil
+			}
+			next = t.clock.Now().Add(t.interval)
+			timer.Reset(t.wait(next))
+		case now := <-timer.C():
+			if err := t.tickFunc(now); err != nil {
+				return err
+			}
+			next = t.next(next)
+			timer.Reset(t.wait(next))
+		}
+	}
+}
+
+// pause waits until the ticker is resumed. Interval changes are
+// still accepted. It returns false if the ticker is stopped.
+func (t *Ticker) pause(l PausableLoop) bool {
+	for {
+		select {
+		case <-l.ShallStop():
+			return false
+		case <-l.ShallResume():
+			return true
+		case interval := <-t.intervalChan:
+			t.interval = interval
+		}
+	}
+}
+
+// next calculates the time of the next tick.
+func (t *Ticker) next(last time.Time) time.Time {
+	now := t.clock.Now()
+	if t.fixedDelay {
+		return now.Add(t.interval)
+	}
+	next := last.Add(t.interval)
+	if t.skipOverlaps && t.interval > 0 {
+		for next.Before(now) {
+			next = next.Add(t.interval)
+		}
+	}
+	return next
+}
+
+// wait returns the duration until the next tick including
+// the jitter.
+func (t *Ticker) wait(next time.Time) time.Duration {
+	d := t.clock.Until(next)
+	if t.jitter > 0 {
+		d += time.Duration(t.jitter * rand.Float64() * float64(t.interval))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// EOF
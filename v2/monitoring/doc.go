@@ -26,7 +26,7 @@ import (
 
 // PackageVersion returns the version of the version package.
 func PackageVersion() version.Version {
-	return version.New(2, 1, 1)
+	return version.New(2, 3, 0)
 }
 
 // EOF
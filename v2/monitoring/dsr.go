@@ -33,7 +33,7 @@ const (
 
 // Register registers a new dynamic status retriever function.
 func Register(id string, rf DynamicStatusRetriever) {
-	monitor.retrieverRegistrationChan <- &retrieverRegistration{id, rf}
+	monitor.cast(&retrieverRegistration{id, rf})
 }
 
 // ReadStatus returns the dynamic status for an id.
@@ -36,7 +36,8 @@ const (
 // BeginMeasuring starts a new measuring with a given id.
 // All measurings with the same id will be aggregated.
 func BeginMeasuring(id string) *Measuring {
-	return &Measuring{id, time.Now(), time.Now()}
+	now := now()
+	return &Measuring{id, now, now}
 }
 
 // Measure the execution of a function.
@@ -106,8 +107,8 @@ type Measuring struct {
 // EndMEasuring ends a measuring and passes it to the
 // measuring server in the background.
 func (m *Measuring) EndMeasuring() time.Duration {
-	m.endTime = time.Now()
-	monitor.measuringChan <- m
+	m.endTime = now()
+	monitor.cast(m)
 	return m.endTime.Sub(m.startTime)
 }
 
@@ -13,8 +13,10 @@ package monitoring
 
 import (
 	"sort"
+	"sync"
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
 	"github.com/tideland/goas/v2/logger"
 	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/goas/v3/errors"
@@ -40,62 +42,35 @@ const (
 
 // command encapsulated the data for any command.
 type command struct {
-	opCode   int
-	args     interface{}
-	respChan chan interface{}
-}
-
-// respond allow to simply respond to a command.
-func (c *command) respond(v interface{}) {
-	c.respChan <- v
-}
-
-// ok is a simple positive response.
-func (c *command) ok() {
-	c.respond(true)
-}
-
-// close closes the response channel.
-func (c *command) close() {
-	close(c.respChan)
+	opCode int
+	args   interface{}
 }
 
 // systemMonitor contains all monitored informations.
 type systemMonitor struct {
-	etmData                   map[string]*MeasuringPoint
-	ssvData                   map[string]*StaySetVariable
-	dsrData                   map[string]DynamicStatusRetriever
-	measuringChan             chan *Measuring
-	ssvChangeChan             chan *ssvChange
-	retrieverRegistrationChan chan *retrieverRegistration
-	commandChan               chan *command
-	backend                   loop.Loop
+	etmData     map[string]*MeasuringPoint
+	ssvData     map[string]*StaySetVariable
+	dsrData     map[string]DynamicStatusRetriever
+	recoverings loop.Recoverings
+	backend     *loop.Actor[interface{}, interface{}]
 }
 
 // newSystemMonitor starts the system monitor.
 func newSystemMonitor() *systemMonitor {
-	m := &systemMonitor{
-		measuringChan:             make(chan *Measuring, 1000),
-		ssvChangeChan:             make(chan *ssvChange, 1000),
-		retrieverRegistrationChan: make(chan *retrieverRegistration, 10),
-		commandChan:               make(chan *command),
-	}
-	m.backend = loop.GoRecoverable(m.backendLoop, m.checkRecovering)
+	m := &systemMonitor{}
+	m.init()
+	m.backend = loop.GoActor(m.handle, 1000)
 	return m
 }
 
 // command sends a command to the system monitor and waits for a response.
 func (m *systemMonitor) command(opCode int, args interface{}) (interface{}, error) {
-	cmd := &command{opCode, args, make(chan interface{})}
-	m.commandChan <- cmd
-	resp, ok := <-cmd.respChan
-	if !ok {
-		return nil, errors.New(ErrMonitorPanicked, errorMessages)
-	}
-	if err, ok := resp.(error); ok {
-		return nil, err
-	}
-	return resp, nil
+	return m.backend.Call(&command{opCode, args})
+}
+
+// cast sends a change to the system monitor without waiting.
+func (m *systemMonitor) cast(change interface{}) {
+	m.backend.Cast(change)
 }
 
 // init the system monitor.
@@ -105,58 +80,56 @@ func (m *systemMonitor) init() {
 	m.dsrData = make(map[string]DynamicStatusRetriever)
 }
 
-// backendLoop runs the system monitor.
-func (m *systemMonitor) backendLoop(l loop.Loop) error {
-	// Init the monitor.
-	m.init()
-	// Run loop.
-	for {
-		select {
-		case <-l.ShallStop():
-			return nil
-		case measuring := <-m.measuringChan:
-			// Received a new measuring.
-			if mp, ok := m.etmData[measuring.id]; ok {
-				mp.update(measuring)
-			} else {
-				m.etmData[measuring.id] = newMeasuringPoint(measuring)
-			}
-		case ssvChange := <-m.ssvChangeChan:
-			// Received a new change.
-			if ssv, ok := m.ssvData[ssvChange.id]; ok {
-				ssv.update(ssvChange)
-			} else {
-				m.ssvData[ssvChange.id] = newStaySetVariable(ssvChange)
-			}
-		case registration := <-m.retrieverRegistrationChan:
-			// Received a new retriever for registration.
-			m.dsrData[registration.id] = registration.dsr
-		case cmd := <-m.commandChan:
-			// Received a command to process.
-			m.processCommand(cmd)
+// handle processes the changes and commands sent to the monitor.
+// Panics are recovered and restart the monitor with cleared data.
+func (m *systemMonitor) handle(req interface{}) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp, err = nil, m.recovered(r)
 		}
+	}()
+	switch r := req.(type) {
+	case *Measuring:
+		// Received a new measuring.
+		if mp, ok := m.etmData[r.id]; ok {
+			mp.update(r)
+		} else {
+			m.etmData[r.id] = newMeasuringPoint(r)
+		}
+	case *ssvChange:
+		// Received a new change.
+		if ssv, ok := m.ssvData[r.id]; ok {
+			ssv.update(r)
+		} else {
+			m.ssvData[r.id] = newStaySetVariable(r)
+		}
+	case *retrieverRegistration:
+		// Received a new retriever for registration.
+		m.dsrData[r.id] = r.dsr
+	case *command:
+		// Received a command to process.
+		return m.processCommand(r)
 	}
+	return nil, nil
 }
 
 // processCommand handles the received commands of the monitor.
-func (m *systemMonitor) processCommand(cmd *command) {
-	defer cmd.close()
+func (m *systemMonitor) processCommand(cmd *command) (interface{}, error) {
 	switch cmd.opCode {
 	case cmdReset:
 		// Reset monitoring.
 		m.init()
-		cmd.ok()
+		return true, nil
 	case cmdMeasuringPointRead:
 		// Read just one measuring point.
 		id := cmd.args.(string)
 		if mp, ok := m.etmData[id]; ok {
 			// Measuring point found.
 			clone := *mp
-			cmd.respond(&clone)
-		} else {
-			// Measuring point does not exist.
-			cmd.respond(errors.New(ErrMeasuringPointNotExists, errorMessages, id))
+			return &clone, nil
 		}
+		// Measuring point does not exist.
+		return nil, errors.New(ErrMeasuringPointNotExists, errorMessages, id)
 	case cmdMeasuringPointsReadAll:
 		// Read all measuring points.
 		resp := MeasuringPoints{}
@@ -165,18 +138,17 @@ func (m *systemMonitor) processCommand(cmd *command) {
 			resp = append(resp, &clone)
 		}
 		sort.Sort(resp)
-		cmd.respond(resp)
+		return resp, nil
 	case cmdStaySetVariableRead:
 		// Read just one stay-set variable.
 		id := cmd.args.(string)
 		if ssv, ok := m.ssvData[id]; ok {
 			// Variable found.
 			clone := *ssv
-			cmd.respond(&clone)
-		} else {
-			// Variable does not exist.
-			cmd.respond(errors.New(ErrStaySetVariableNotExists, errorMessages, id))
+			return &clone, nil
 		}
+		// Variable does not exist.
+		return nil, errors.New(ErrStaySetVariableNotExists, errorMessages, id)
 	case cmdStaySetVariablesReadAll:
 		// Read all stay-set variables.
 		resp := StaySetVariables{}
@@ -185,7 +157,7 @@ func (m *systemMonitor) processCommand(cmd *command) {
 			resp = append(resp, &clone)
 		}
 		sort.Sort(resp)
-		cmd.respond(resp)
+		return resp, nil
 	case cmdDynamicStatusRetrieverRead:
 		// Read just one dynamic status value.
 		id := cmd.args.(string)
@@ -193,38 +165,44 @@ func (m *systemMonitor) processCommand(cmd *command) {
 			// Dynamic status found.
 			v, err := dsr()
 			if err != nil {
-				cmd.respond(err)
-			} else {
-				cmd.respond(v)
+				return nil, err
 			}
-		} else {
-			// Dynamic status does not exist.
-			cmd.respond(errors.New(ErrDynamicStatusNotExists, errorMessages, id))
+			return v, nil
 		}
+		// Dynamic status does not exist.
+		return nil, errors.New(ErrDynamicStatusNotExists, errorMessages, id)
 	case cmdDynamicStatusRetrieversReadAll:
 		// Read all dynamic status values.
 		resp := DynamicStatusValues{}
 		for id, dsr := range m.dsrData {
 			v, err := dsr()
 			if err != nil {
-				cmd.respond(err)
+				return nil, err
 			}
 			dsv := &DynamicStatusValue{id, v}
 			resp = append(resp, dsv)
 		}
 		sort.Sort(resp)
-		cmd.respond(resp)
+		return resp, nil
 	}
+	return nil, nil
 }
 
-// checkRecovering checks if the backend can be recovered.
-func (m *systemMonitor) checkRecovering(rs loop.Recoverings) (loop.Recoverings, error) {
-	if rs.Frequency(12, time.Minute) {
-		logger.Errorf("monitor cannot be recovered: %v", rs.Last().Reason)
-		return nil, errors.New(ErrMonitorCannotBeRecovered, errorMessages, rs.Last().Reason)
+// recovered checks if the monitor can be recovered after a panic.
+// In this case its data is cleared like after a restart, otherwise
+// the monitor is stopped.
+func (m *systemMonitor) recovered(reason interface{}) error {
+	m.recoverings = append(m.recoverings, &loop.Recovering{Time: now(), Reason: reason})
+	if m.recoverings.Frequency(12, time.Minute) {
+		logger.Errorf("monitor cannot be recovered: %v", reason)
+		err := errors.New(ErrMonitorCannotBeRecovered, errorMessages, reason)
+		m.backend.Kill(err)
+		return err
 	}
-	logger.Warningf("monitor recovered: %v", rs.Last().Reason)
-	return rs.Trim(12), nil
+	logger.Warningf("monitor recovered: %v", reason)
+	m.recoverings = m.recoverings.Trim(12)
+	m.init()
+	return errors.New(ErrMonitorPanicked, errorMessages)
 }
 
 //--------------------
@@ -234,6 +212,12 @@ func (m *systemMonitor) checkRecovering(rs loop.Recoverings) (loop.Recoverings,
 // monitor is the one global monitor instance.
 var monitor *systemMonitor = newSystemMonitor()
 
+// clockMux protects the clock of the monitoring.
+var clockMux sync.Mutex
+
+// monitorClock is the clock used for measuring.
+var monitorClock clock.Clock = clock.Real()
+
 // Reset clears all monitored values.
 func Reset() error {
 	_, err := monitor.command(cmdReset, nil)
@@ -243,4 +227,22 @@ func Reset() error {
 	return nil
 }
 
+// SetClock sets the clock used for the execution time measuring
+// and returns the former one. Default is the real clock, tests
+// can set a fake one.
+func SetClock(c clock.Clock) clock.Clock {
+	clockMux.Lock()
+	defer clockMux.Unlock()
+	old := monitorClock
+	monitorClock = c
+	return old
+}
+
+// now returns the current time of the monitoring clock.
+func now() time.Time {
+	clockMux.Lock()
+	defer clockMux.Unlock()
+	return monitorClock.Now()
+}
+
 // EOF
@@ -17,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
 	"github.com/tideland/goas/v2/monitoring"
 	"github.com/tideland/gots/v3/asserts"
 )
@@ -53,6 +54,29 @@ func TestEtmMonitor(t *testing.T) {
 	})
 }
 
+// Test of the ETM monitor with a fake clock.
+func TestEtmClock(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	c := clock.NewFake(time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC))
+	old := monitoring.SetClock(c)
+	defer monitoring.SetClock(old)
+	defer monitoring.Reset()
+	// Generate measurings.
+	for i := 1; i <= 3; i++ {
+		d := monitoring.Measure("mp:clock", func() {
+			c.Advance(time.Duration(i) * time.Second)
+		})
+		assert.Equal(d, time.Duration(i)*time.Second, "duration of the fake clock")
+	}
+	// Asserts.
+	mp, err := monitoring.ReadMeasuringPoint("mp:clock")
+	assert.Nil(err)
+	assert.Equal(mp.Count, int64(3))
+	assert.Equal(mp.MinDuration, time.Second)
+	assert.Equal(mp.MaxDuration, 3*time.Second)
+	assert.True(mp.MinDuration <= mp.AvgDuration && mp.AvgDuration <= mp.MaxDuration, "avg between min and max")
+}
+
 // Test of the SSI monitor.
 func TestSsiMonitor(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
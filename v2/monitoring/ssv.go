@@ -34,17 +34,17 @@ const (
 
 // SetVariable sets a value of a stay-set variable.
 func SetVariable(id string, v int64) {
-	monitor.ssvChangeChan <- &ssvChange{id, true, v}
+	monitor.cast(&ssvChange{id, true, v})
 }
 
 // IncrVariable increases a variable.
 func IncrVariable(id string) {
-	monitor.ssvChangeChan <- &ssvChange{id, false, 1}
+	monitor.cast(&ssvChange{id, false, 1})
 }
 
 // DecrVariable decreases a variable.
 func DecrVariable(id string) {
-	monitor.ssvChangeChan <- &ssvChange{id, false, -1}
+	monitor.cast(&ssvChange{id, false, -1})
 }
 
 // ReadVariable returns the stay-set variable for an id.
@@ -0,0 +1,202 @@
+// Tideland Go Application Support - Time Extensions - Concurrency Policies
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package timex
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v2/logger"
+	"github.com/tideland/goas/v2/monitoring"
+)
+
+//--------------------
+// CONCURRENCY POLICIES
+//--------------------
+
+// ConcurrencyPolicy defines what happens if a job shall be executed
+// while a previous execution is still running.
+type ConcurrencyPolicy int
+
+// Concurrency policies of crontab jobs.
+const (
+	// AllowConcurrent starts the new execution in parallel.
+	AllowConcurrent ConcurrencyPolicy = iota
+
+	// SkipIfRunning skips the new execution.
+	SkipIfRunning
+
+	// QueueOne starts the new execution after the running one
+	// ended. Only one execution is queued, further ones are
+	// skipped.
+	QueueOne
+
+	// ReplaceRunning cancels the running execution if the job
+	// implements CancelableJob and starts the new one. The result
+	// of the replaced execution is ignored.
+	ReplaceRunning
+)
+
+// policyNames contains the names of the concurrency policies.
+var policyNames = map[ConcurrencyPolicy]string{
+	AllowConcurrent: "allow concurrent",
+	SkipIfRunning:   "skip if running",
+	QueueOne:        "queue one",
+	ReplaceRunning:  "replace running",
+}
+
+// String returns the name of the concurrency policy.
+func (p ConcurrencyPolicy) String() string {
+	return policyNames[p]
+}
+
+// CancelableJob is a job whose running executions can be canceled.
+// It's used by the policy ReplaceRunning.
+type CancelableJob interface {
+	Job
+
+	// Cancel asks the running executions to end.
+	Cancel()
+}
+
+// JobOption allows to configure a job when adding it to a crontab.
+type JobOption func(s *jobState)
+
+// WithPolicy sets the concurrency policy of a job. Default
+// is AllowConcurrent.
+func WithPolicy(p ConcurrencyPolicy) JobOption {
+	return func(s *jobState) {
+		s.status.Policy = p
+	}
+}
+
+// WithMaxRunning limits the number of jobs executing at the same
+// time. Further executions wait until a running one ended, they are
+// reported as waiting in the job status. Default is no limit.
+func WithMaxRunning(n int) CrontabOption {
+	return func(c *Crontab) {
+		if n > 0 {
+			c.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// start starts an execution of a job according to its
+// concurrency policy.
+func (c *Crontab) start(id string, job Job) {
+	c.statusMux.Lock()
+	state, ok := c.states[id]
+	if !ok {
+		c.statusMux.Unlock()
+		return
+	}
+	cancel := false
+	if state.status.Running+state.status.Waiting > 0 {
+		switch state.status.Policy {
+		case SkipIfRunning:
+			c.skip(id, state)
+			return
+		case QueueOne:
+			if state.status.Queued {
+				c.skip(id, state)
+				return
+			}
+			state.status.Queued = true
+			c.statusMux.Unlock()
+			return
+		case ReplaceRunning:
+			state.generation++
+			cancel = true
+		}
+	}
+	c.enter(state)
+	generation := state.generation
+	c.statusMux.Unlock()
+	if cj, ok := job.(CancelableJob); ok && cancel {
+		cj.Cancel()
+	}
+	go c.run(id, job, state, generation)
+}
+
+// skip counts a skipped execution and unlocks the states.
+func (c *Crontab) skip(id string, state *jobState) {
+	state.status.Skipped++
+	c.statusMux.Unlock()
+	if c.monitoring != "" {
+		monitoring.IncrVariable(c.monitoring + "::" + id + "::skipped")
+	}
+}
+
+// enter counts a new execution as waiting for a slot or, without
+// a limit, as running. The states have to be locked.
+func (c *Crontab) enter(state *jobState) {
+	if c.slots != nil {
+		state.status.Waiting++
+		return
+	}
+	state.status.Running++
+}
+
+// acquire waits for a free slot if the number of executing jobs is
+// limited. It returns false if the waiting execution has been replaced
+// in the meantime and shall not be executed anymore.
+func (c *Crontab) acquire(state *jobState, generation int) bool {
+	if c.slots == nil {
+		return true
+	}
+	c.slots <- struct{}{}
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	state.status.Waiting--
+	if generation != state.generation {
+		<-c.slots
+		return false
+	}
+	state.status.Running++
+	return true
+}
+
+// run executes a job, followed by a queued execution if
+// there's one. The result of replaced executions is ignored.
+func (c *Crontab) run(id string, job Job, state *jobState, generation int) {
+	for {
+		if !c.acquire(state, generation) {
+			return
+		}
+		cont, err := c.execute(id, job)
+		if c.slots != nil {
+			<-c.slots
+		}
+		c.statusMux.Lock()
+		replaced := generation != state.generation
+		again := state.status.Queued && !replaced && err == nil && cont
+		state.status.Queued = state.status.Queued && !again
+		state.status.Running--
+		if again {
+			c.enter(state)
+		}
+		c.statusMux.Unlock()
+		if replaced {
+			return
+		}
+		if err != nil {
+			logger.Errorf("job %q removed after error: %v", id, err)
+			cont = false
+		}
+		if !cont {
+			c.Remove(id)
+			return
+		}
+		if !again {
+			return
+		}
+	}
+}
+
+// EOF
@@ -0,0 +1,627 @@
+// Tideland Go Application Support - Time Extensions - Cron Expressions
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package timex
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CRON FIELDS
+//--------------------
+
+// cronField describes one field of a cron expression.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	secondField = &cronField{"second", 0, 59, nil}
+	minuteField = &cronField{"minute", 0, 59, nil}
+	hourField   = &cronField{"hour", 0, 23, nil}
+	dayField    = &cronField{"day", 1, 31, nil}
+	monthField  = &cronField{"month", 1, 12, map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	weekdayField = &cronField{"weekday", 0, 7, map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+// cronMacros contains the predefined schedules.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// value parses a single number or name of the field.
+func (f *cronField) value(s string) (int, error) {
+	v, ok := f.names[strings.ToUpper(s)]
+	if !ok {
+		var err error
+		v, err = strconv.Atoi(s)
+		if err != nil {
+			return 0, errors.New(ErrInvalidCronField, errorMessages, f.name, s)
+		}
+	}
+	if v < f.min || v > f.max {
+		return 0, errors.New(ErrCronValueOutOfRange, errorMessages, f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// item parses one item of a list, a value, a range, or the
+// wildcard, each optionally with a step.
+func (f *cronField) item(s string) (uint64, error) {
+	rangePart := s
+	step := 1
+	stepped := false
+	if i := strings.Index(s, "/"); i >= 0 {
+		rangePart = s[:i]
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n < 1 {
+			return 0, errors.New(ErrInvalidCronField, errorMessages, f.name, s)
+		}
+		step = n
+		stepped = true
+	}
+	var lo, hi int
+	var err error
+	switch {
+	case rangePart == "*":
+		lo, hi = f.min, f.max
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		if lo, err = f.value(bounds[0]); err != nil {
+			return 0, err
+		}
+		if hi, err = f.value(bounds[1]); err != nil {
+			return 0, err
+		}
+		if lo > hi {
+			return 0, errors.New(ErrInvalidCronField, errorMessages, f.name, s)
+		}
+	default:
+		if lo, err = f.value(rangePart); err != nil {
+			return 0, err
+		}
+		hi = lo
+		if stepped {
+			hi = f.max
+		}
+	}
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+// parse parses a whole field. Items not handled by the
+// function for extensions are parsed as standard items.
+func (f *cronField) parse(s string, extension func(item string) (bool, error)) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		if item == "" {
+			return 0, errors.New(ErrInvalidCronField, errorMessages, f.name, s)
+		}
+		if extension != nil {
+			handled, err := extension(item)
+			if err != nil {
+				return 0, err
+			}
+			if handled {
+				continue
+			}
+		}
+		ibits, err := f.item(item)
+		if err != nil {
+			return 0, err
+		}
+		bits |= ibits
+	}
+	return bits, nil
+}
+
+//--------------------
+// SCHEDULE
+//--------------------
+
+// nthWeekday is the nth weekday of a month.
+type nthWeekday struct {
+	weekday time.Weekday
+	n       int
+}
+
+// Schedule is a parsed cron expression. It consists of five fields
+// for minute, hour, day of month, month, and day of week or six
+// fields with a leading one for the second. Fields can contain
+// lists, ranges, and steps like "1,15", "MON-FRI", or "*/10". Days
+// of month additionally support "L" for the last day, "L-n" for n
+// days before it, "nW" for the nearest weekday to day n, and "LW"
+// for the last weekday. Days of week support "nL" for the last day
+// n of the month and "n#m" for the mth day n of the month. If both
+// days fields are restricted a time matches if one of them matches.
+// Fields starting with "*" like "*/2" are not restricted.
+// A leading "TZ=<zone>" or "CRON_TZ=<zone>" sets the location the
+// schedule is evaluated in.
+type Schedule struct {
+	expr            string
+	location        *time.Location
+	withSeconds     bool
+	seconds         uint64
+	minutes         uint64
+	hours           uint64
+	days            uint64
+	months          uint64
+	weekdays        uint64
+	anyDay          bool
+	anyWeekday      bool
+	lastDays        []int
+	nearestWeekdays []int
+	lastWorkday     bool
+	lastWeekdays    []time.Weekday
+	nthWeekdays     []nthWeekday
+}
+
+// ParseSchedule parses a cron expression with five or six fields
+// or one of the macros @yearly, @annually, @monthly, @weekly,
+// @daily, @midnight, or @hourly. Without a time zone prefix the
+// schedule is evaluated in the location of the passed times.
+func ParseSchedule(expr string) (*Schedule, error) {
+	return ParseScheduleIn(expr, nil)
+}
+
+// ParseScheduleIn parses a cron expression like ParseSchedule but
+// evaluates it in the given location. A time zone prefix of the
+// expression takes precedence.
+func ParseScheduleIn(expr string, loc *time.Location) (*Schedule, error) {
+	s := &Schedule{
+		expr:     expr,
+		location: loc,
+	}
+	spec := strings.TrimSpace(expr)
+	for _, prefix := range []string{"TZ=", "CRON_TZ="} {
+		if !strings.HasPrefix(spec, prefix) {
+			continue
+		}
+		name := strings.Fields(spec)[0]
+		spec = strings.TrimSpace(spec[len(name):])
+		name = name[len(prefix):]
+		zone, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, errors.Annotate(err, ErrUnknownTimeZone, errorMessages, name)
+		}
+		s.location = zone
+		break
+	}
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := cronMacros[strings.ToLower(spec)]
+		if !ok {
+			return nil, errors.New(ErrUnknownCronMacro, errorMessages, spec)
+		}
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+		s.withSeconds = true
+	default:
+		return nil, errors.New(ErrCronFieldCount, errorMessages, expr, len(fields))
+	}
+	var err error
+	if s.seconds, err = secondField.parse(fields[0], nil); err != nil {
+		return nil, err
+	}
+	if s.minutes, err = minuteField.parse(fields[1], nil); err != nil {
+		return nil, err
+	}
+	if s.hours, err = hourField.parse(fields[2], nil); err != nil {
+		return nil, err
+	}
+	if s.days, s.anyDay, err = s.parseDays(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.months, err = monthField.parse(fields[4], nil); err != nil {
+		return nil, err
+	}
+	if s.weekdays, s.anyWeekday, err = s.parseWeekdays(fields[5]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseDays parses the day of month field with its extensions.
+func (s *Schedule) parseDays(field string) (uint64, bool, error) {
+	any := strings.HasPrefix(field, "*") || field == "?"
+	if field == "*" || field == "?" {
+		bits, err := dayField.item("*")
+		return bits, any, err
+	}
+	bits, err := dayField.parse(field, func(item string) (bool, error) {
+		switch {
+		case item == "L":
+			s.lastDays = append(s.lastDays, 0)
+		case item == "LW":
+			s.lastWorkday = true
+		case strings.HasPrefix(item, "L-"):
+			offset, err := strconv.Atoi(item[2:])
+			if err != nil {
+				return false, errors.New(ErrInvalidCronField, errorMessages, dayField.name, item)
+			}
+			if offset < 0 || offset > 30 {
+				return false, errors.New(ErrCronValueOutOfRange, errorMessages, dayField.name, offset, 0, 30)
+			}
+			s.lastDays = append(s.lastDays, offset)
+		case strings.HasSuffix(item, "W"):
+			day, err := dayField.value(item[:len(item)-1])
+			if err != nil {
+				return false, err
+			}
+			s.nearestWeekdays = append(s.nearestWeekdays, day)
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+	return bits, any, err
+}
+
+// parseWeekdays parses the day of week field with its extensions.
+// Sunday can be 0 or 7.
+func (s *Schedule) parseWeekdays(field string) (uint64, bool, error) {
+	any := strings.HasPrefix(field, "*") || field == "?"
+	if field == "?" {
+		field = "*"
+	}
+	bits, err := weekdayField.parse(field, func(item string) (bool, error) {
+		switch {
+		case strings.Contains(item, "#"):
+			parts := strings.SplitN(item, "#", 2)
+			weekday, err := weekdayField.value(parts[0])
+			if err != nil {
+				return false, err
+			}
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return false, errors.New(ErrInvalidCronField, errorMessages, weekdayField.name, item)
+			}
+			if n < 1 || n > 5 {
+				return false, errors.New(ErrCronValueOutOfRange, errorMessages, weekdayField.name, n, 1, 5)
+			}
+			s.nthWeekdays = append(s.nthWeekdays, nthWeekday{time.Weekday(weekday % 7), n})
+		case len(item) > 1 && strings.HasSuffix(item, "L"):
+			weekday, err := weekdayField.value(item[:len(item)-1])
+			if err != nil {
+				return false, err
+			}
+			s.lastWeekdays = append(s.lastWeekdays, time.Weekday(weekday%7))
+		default:
+			return false, nil
+		}
+		return true, nil
+	})
+	if bits&(1<<7) != 0 {
+		bits = bits&^(1<<7) | 1
+	}
+	return bits, any, err
+}
+
+// String returns the cron expression of the schedule.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Location returns the location the schedule is evaluated in. It
+// is nil if the location of the passed times is used.
+func (s *Schedule) Location() *time.Location {
+	return s.location
+}
+
+// Resolution returns the smallest unit of the schedule, a second
+// for expressions with six fields, otherwise a minute.
+func (s *Schedule) Resolution() time.Duration {
+	if s.withSeconds {
+		return time.Second
+	}
+	return time.Minute
+}
+
+// Matches checks if the time matches the schedule. The seconds
+// are only checked for expressions with six fields.
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.matchesWallClock(s.in(t))
+}
+
+// matchesWallClock checks the fields of the time as they are,
+// without converting it into the location of the schedule.
+func (s *Schedule) matchesWallClock(t time.Time) bool {
+	if s.withSeconds && !hasBit(s.seconds, t.Second()) {
+		return false
+	}
+	if !hasBit(s.minutes, t.Minute()) || !hasBit(s.hours, t.Hour()) || !hasBit(s.months, int(t.Month())) {
+		return false
+	}
+	return s.matchesDays(t)
+}
+
+// matchesDays checks the day of month and the day of week. If
+// both are restricted one of them has to match.
+func (s *Schedule) matchesDays(t time.Time) bool {
+	day := s.matchesDay(t)
+	weekday := s.matchesWeekday(t)
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// Next returns the first time after t matching the schedule in its
+// location. Wall clock times skipped when the clocks are put forward
+// are executed once at the first instant after the gap, times repeated
+// when the clocks are put back only at their first occurrence. Schedules
+// running every hour instead continue in elapsed time, so they skip the
+// gap and run during both occurrences of a repeated hour. Next returns
+// the zero time if there's none in the next five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = s.in(t)
+	loc := t.Location()
+	res := s.Resolution()
+	everyHour := s.hours == allHours
+	prev := t
+	next := startOfNext(t, res)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		if !everyHour {
+			if start, ok := s.skipped(prev, next); ok {
+				return start
+			}
+		}
+		prev = next
+		switch {
+		case !hasBit(s.months, int(next.Month())):
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDays(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+		case !hasBit(s.hours, next.Hour()):
+			next = startOfNext(next, time.Hour)
+		case !hasBit(s.minutes, next.Minute()):
+			next = startOfNext(next, time.Minute)
+		case s.withSeconds && !hasBit(s.seconds, next.Second()):
+			next = startOfNext(next, time.Second)
+		case !everyHour && isRepeated(next):
+			next = startOfNext(next, res)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// skipped checks if the clocks have been put forward after prev up
+// to next and if a skipped wall clock time matches the schedule. In
+// this case it returns the first instant after the gap.
+func (s *Schedule) skipped(prev, next time.Time) (time.Time, bool) {
+	_, before := prev.Zone()
+	_, after := next.Zone()
+	if after <= before {
+		return time.Time{}, false
+	}
+	start, _ := next.ZoneBounds()
+	if !start.After(prev) {
+		return time.Time{}, false
+	}
+	start = start.In(next.Location())
+	wall := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+	for w := wall.Add(-time.Duration(after-before) * time.Second); w.Before(wall); w = w.Add(s.Resolution()) {
+		if s.matchesWallClock(w) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// in converts the time into the location of the schedule if set.
+func (s *Schedule) in(t time.Time) time.Time {
+	if s.location == nil {
+		return t
+	}
+	return t.In(s.location)
+}
+
+// ShallExecute returns true if the time matches the schedule. This
+// way a schedule can be embedded in own job types.
+func (s *Schedule) ShallExecute(t time.Time) bool {
+	return s.Matches(t)
+}
+
+// matchesDay checks the day of month including the extensions.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	day := t.Day()
+	if hasBit(s.days, day) {
+		return true
+	}
+	last := daysIn(t.Year(), t.Month())
+	for _, offset := range s.lastDays {
+		if day == last-offset {
+			return true
+		}
+	}
+	if s.lastWorkday && day == nearestWorkday(t.Year(), t.Month(), last) {
+		return true
+	}
+	for _, n := range s.nearestWeekdays {
+		if n <= last && day == nearestWorkday(t.Year(), t.Month(), n) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekday checks the day of week including the extensions.
+func (s *Schedule) matchesWeekday(t time.Time) bool {
+	weekday := t.Weekday()
+	if hasBit(s.weekdays, int(weekday)) {
+		return true
+	}
+	day := t.Day()
+	for _, lw := range s.lastWeekdays {
+		if weekday == lw && day+7 > daysIn(t.Year(), t.Month()) {
+			return true
+		}
+	}
+	for _, nw := range s.nthWeekdays {
+		if weekday == nw.weekday && (day-1)/7+1 == nw.n {
+			return true
+		}
+	}
+	return false
+}
+
+//--------------------
+// SCHEDULED JOB
+//--------------------
+
+// ExecuteFunc is executed by a scheduled job. If it returns
+// false or an error the job will be removed from the crontab.
+type ExecuteFunc func() (bool, error)
+
+// scheduledJob executes a function based on a schedule.
+type scheduledJob struct {
+	schedule *Schedule
+	execute  ExecuteFunc
+	planned  bool
+	due      time.Time
+}
+
+// NewScheduledJob returns a job executing the function when the
+// schedule matches. It's executed once per due time as returned by
+// the Next method of the schedule, so the crontab may check it more
+// often and the time zone transitions are handled the same way.
+func NewScheduledJob(s *Schedule, ef ExecuteFunc) ScheduledJob {
+	return &scheduledJob{
+		schedule: s,
+		execute:  ef,
+	}
+}
+
+// NewCronJob parses the cron expression and returns a scheduled
+// job for it.
+func NewCronJob(expr string, ef ExecuteFunc) (ScheduledJob, error) {
+	s, err := ParseSchedule(expr)
+	if err != nil {
+		return nil, err
+	}
+	return NewScheduledJob(s, ef), nil
+}
+
+// ShallExecute is specified on the Job interface.
+func (j *scheduledJob) ShallExecute(t time.Time) bool {
+	if !j.planned {
+		j.due = j.schedule.Next(t.Add(-j.schedule.Resolution()))
+		j.planned = true
+	}
+	if j.due.IsZero() || t.Before(j.due) {
+		return false
+	}
+	j.due = j.schedule.Next(t)
+	return true
+}
+
+// Execute is specified on the Job interface.
+func (j *scheduledJob) Execute() (bool, error) {
+	return j.execute()
+}
+
+// Next is specified on the ScheduledJob interface.
+func (j *scheduledJob) Next(t time.Time) time.Time {
+	return j.schedule.Next(t)
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// allHours has the bits of all hours set.
+const allHours = 1<<24 - 1
+
+// hasBit checks if the bit for the value is set.
+func hasBit(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// daysIn returns the number of days of the month.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// startOfNext returns the start of the wall clock unit, a second, a
+// minute, or an hour, following the one of t. It moves in elapsed
+// time, so it crosses time zone transitions like a clock does.
+func startOfNext(t time.Time, unit time.Duration) time.Time {
+	elapsed := time.Duration(t.Nanosecond())
+	if unit >= time.Minute {
+		elapsed += time.Duration(t.Second()) * time.Second
+	}
+	if unit >= time.Hour {
+		elapsed += time.Duration(t.Minute()) * time.Minute
+	}
+	return t.Add(unit - elapsed)
+}
+
+// isRepeated checks if the wall clock time of t already occurred
+// before the clocks have been put back.
+func isRepeated(t time.Time) bool {
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return false
+	}
+	_, before := start.Add(-time.Second).Zone()
+	_, offset := t.Zone()
+	return before > offset && t.Sub(start) < time.Duration(before-offset)*time.Second
+}
+
+// nearestWorkday returns the weekday from Monday to Friday nearest
+// to the day without leaving the month.
+func nearestWorkday(year int, month time.Month, day int) int {
+	last := daysIn(year, month)
+	switch time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday() {
+	case time.Saturday:
+		if day > 1 {
+			return day - 1
+		}
+		return day + 2
+	case time.Sunday:
+		if day < last {
+			return day + 1
+		}
+		return day - 2
+	}
+	return day
+}
+
+// EOF
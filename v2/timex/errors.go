@@ -0,0 +1,82 @@
+// Tideland Go Application Support - Time Extensions - Errors
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package timex
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	ErrCrontabCannotBeRecovered = iota + 1
+	ErrCronFieldCount
+	ErrUnknownCronMacro
+	ErrInvalidCronField
+	ErrCronValueOutOfRange
+	ErrUnknownTimeZone
+	ErrJobNotFound
+)
+
+var errorMessages = errors.Messages{
+	ErrCrontabCannotBeRecovered: "crontab cannot be recovered: %v",
+	ErrCronFieldCount:           "cron expression %q has %d fields instead of 5 or 6",
+	ErrUnknownCronMacro:         "unknown cron macro %q",
+	ErrInvalidCronField:         "invalid %s field %q",
+	ErrCronValueOutOfRange:      "%s value %d is out of range %d-%d",
+	ErrUnknownTimeZone:          "unknown time zone %q",
+	ErrJobNotFound:              "job %q not found",
+}
+
+//--------------------
+// TESTING
+//--------------------
+
+// IsCronFieldCountError returns true, if the error signals that
+// a cron expression has a wrong number of fields.
+func IsCronFieldCountError(err error) bool {
+	return errors.IsError(err, ErrCronFieldCount)
+}
+
+// IsUnknownCronMacroError returns true, if the error signals that
+// a cron macro like @daily is unknown.
+func IsUnknownCronMacroError(err error) bool {
+	return errors.IsError(err, ErrUnknownCronMacro)
+}
+
+// IsInvalidCronFieldError returns true, if the error signals that
+// a field of a cron expression has an invalid syntax.
+func IsInvalidCronFieldError(err error) bool {
+	return errors.IsError(err, ErrInvalidCronField)
+}
+
+// IsCronValueOutOfRangeError returns true, if the error signals
+// that a value of a cron expression is out of its range.
+func IsCronValueOutOfRangeError(err error) bool {
+	return errors.IsError(err, ErrCronValueOutOfRange)
+}
+
+// IsUnknownTimeZoneError returns true, if the error signals that
+// the time zone of a cron expression cannot be loaded.
+func IsUnknownTimeZoneError(err error) bool {
+	return errors.IsError(err, ErrUnknownTimeZone)
+}
+
+// IsJobNotFoundError returns true, if the error signals that
+// no job with the given id is registered at the crontab.
+func IsJobNotFoundError(err error) bool {
+	return errors.IsError(err, ErrJobNotFound)
+}
+
+// EOF
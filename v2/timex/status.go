@@ -0,0 +1,178 @@
+// Tideland Go Application Support - Time Extensions - Job Status
+//
+// Copyright (C) 2009-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package timex
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tideland/goas/v2/monitoring"
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// JOB STATUS
+//--------------------
+
+// JobRun describes one execution of a job.
+type JobRun struct {
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// JobStatus describes a job registered at a crontab. Running counts
+// the executions currently executing, Waiting those waiting for a free
+// slot of a crontab started with WithMaxRunning(). Queued signals an
+// execution queued due to the policy QueueOne, and Skipped counts the
+// executions not started due to the concurrency policy. Next is the
+// zero time for jobs not implementing ScheduledJob or without any
+// more executions. History contains the latest runs, the newest one
+// last.
+type JobStatus struct {
+	ID           string
+	Policy       ConcurrencyPolicy
+	Running      int
+	Waiting      int
+	Queued       bool
+	Skipped      int
+	Runs         int
+	LastStart    time.Time
+	LastDuration time.Duration
+	LastError    error
+	Next         time.Time
+	History      []JobRun
+}
+
+// jobState contains the status of a job and the data needed
+// to apply its concurrency policy.
+type jobState struct {
+	status     JobStatus
+	generation int
+}
+
+// WithHistory sets the number of runs kept per job. Default is 10.
+func WithHistory(size int) CrontabOption {
+	return func(c *Crontab) {
+		c.historySize = size
+	}
+}
+
+// WithMonitoring lets the crontab measure the executions of its jobs
+// with the measuring points "<prefix>::<id>" and count their errors
+// with the stay-set variables "<prefix>::<id>::errors".
+func WithMonitoring(prefix string) CrontabOption {
+	return func(c *Crontab) {
+		c.monitoring = prefix
+	}
+}
+
+// Jobs returns the status of all registered jobs ordered by id.
+func (c *Crontab) Jobs() []*JobStatus {
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	statuses := make([]*JobStatus, 0, len(c.states))
+	for _, state := range c.states {
+		statuses = append(statuses, state.status.copy())
+	}
+	sort.Sort(jobStatuses(statuses))
+	return statuses
+}
+
+// Job returns the status of the registered job with the id.
+func (c *Crontab) Job(id string) (*JobStatus, error) {
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	state, ok := c.states[id]
+	if !ok {
+		return nil, errors.New(ErrJobNotFound, errorMessages, id)
+	}
+	return state.status.copy(), nil
+}
+
+// register adds the status of a new job.
+func (c *Crontab) register(id string, opts []JobOption) {
+	state := &jobState{
+		status: JobStatus{ID: id},
+	}
+	for _, opt := range opts {
+		opt(state)
+	}
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	c.states[id] = state
+}
+
+// unregister removes the status of a job.
+func (c *Crontab) unregister(id string) {
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	delete(c.states, id)
+}
+
+// scheduled sets the next execution of a job.
+func (c *Crontab) scheduled(id string, next time.Time) {
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	if state, ok := c.states[id]; ok {
+		state.status.Next = next
+	}
+}
+
+// execute executes a job and records its run.
+func (c *Crontab) execute(id string, job Job) (bool, error) {
+	var measuring *monitoring.Measuring
+	if c.monitoring != "" {
+		measuring = monitoring.BeginMeasuring(c.monitoring + "::" + id)
+	}
+	start := c.clock.Now()
+	cont, err := job.Execute()
+	run := JobRun{start, c.clock.Since(start), err}
+	if measuring != nil {
+		measuring.EndMeasuring()
+		if err != nil {
+			monitoring.IncrVariable(c.monitoring + "::" + id + "::errors")
+		}
+	}
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	if state, ok := c.states[id]; ok {
+		status := &state.status
+		status.Runs++
+		status.LastStart = run.Start
+		status.LastDuration = run.Duration
+		status.LastError = run.Err
+		if c.historySize > 0 {
+			if len(status.History) == c.historySize {
+				status.History = append(status.History[:0], status.History[1:]...)
+			}
+			status.History = append(status.History, run)
+		}
+	}
+	return cont, err
+}
+
+// copy returns a copy of the status not sharing the history.
+func (s *JobStatus) copy() *JobStatus {
+	cs := *s
+	cs.History = append([]JobRun(nil), s.History...)
+	return &cs
+}
+
+// jobStatuses sorts job statuses by id.
+type jobStatuses []*JobStatus
+
+func (s jobStatuses) Len() int           { return len(s) }
+func (s jobStatuses) Less(i, j int) bool { return s[i].ID < s[j].ID }
+func (s jobStatuses) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// EOF
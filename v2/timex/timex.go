@@ -12,33 +12,23 @@ package timex
 //--------------------
 
 import (
+	"sync"
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
 	"github.com/tideland/goas/v1/version"
 	"github.com/tideland/goas/v2/logger"
 	"github.com/tideland/goas/v2/loop"
 	"github.com/tideland/goas/v3/errors"
 )
 
-//--------------------
-// CONSTANTS
-//--------------------
-
-const (
-	ErrCrontabCannotBeRecovered = iota + 1
-)
-
-var errorMessages = errors.Messages{
-	ErrCrontabCannotBeRecovered: "crontab cannot be recovered: %v",
-}
-
 //--------------------
 // VERSION
 //--------------------
 
 // PackageVersion returns the version of the version package.
 func PackageVersion() version.Version {
-	return version.New(2, 1, 0)
+	return version.New(2, 8, 0)
 }
 
 //--------------------
@@ -166,6 +156,15 @@ type Job interface {
 	Execute() (bool, error)
 }
 
+// ScheduledJob is a job knowing the time of its next execution.
+type ScheduledJob interface {
+	Job
+
+	// Next returns the time of the next execution after t
+	// or the zero time if there's none.
+	Next(t time.Time) time.Time
+}
+
 // cronCommand operates on a crontab.
 type command struct {
 	add bool
@@ -173,23 +172,74 @@ type command struct {
 	job Job
 }
 
+// CrontabOption allows to configure a crontab when creating it.
+type CrontabOption func(c *Crontab)
+
+// WithClock sets the clock of the crontab. Default is the real
+// clock, tests can pass a fake one.
+func WithClock(clk clock.Clock) CrontabOption {
+	return func(c *Crontab) {
+		c.clock = clk
+	}
+}
+
+// WithSleepMode lets the crontab sleep until the nearest next
+// execution of its scheduled jobs instead of checking all jobs with
+// its frequency. Jobs not implementing ScheduledJob are still checked
+// with the frequency. A frequency of zero or less turns this polling
+// off, so those jobs are never checked.
+func WithSleepMode() CrontabOption {
+	return func(c *Crontab) {
+		c.sleepMode = true
+	}
+}
+
+// WithLocation sets the location the times passed to the jobs are
+// converted to. Default is the location of the clock. Scheduled jobs
+// with an own location still use that one.
+func WithLocation(loc *time.Location) CrontabOption {
+	return func(c *Crontab) {
+		c.location = loc
+	}
+}
+
 // Crontab is one cron server. A system can run multiple in
 // parallel.
 type Crontab struct {
 	jobs        map[string]Job
+	nexts       map[string]time.Time
 	commandChan chan *command
-	ticker      *time.Ticker
+	freq        time.Duration
+	sleepMode   bool
+	location    *time.Location
+	historySize int
+	monitoring  string
+	statusMux   sync.Mutex
+	states      map[string]*jobState
+	slots       chan struct{}
+	clock       clock.Clock
+	ticker      clock.Ticker
 	loop        loop.Loop
 }
 
 // NewCrontab creates a cron server.
-func NewCrontab(freq time.Duration) *Crontab {
+func NewCrontab(freq time.Duration, opts ...CrontabOption) *Crontab {
 	c := &Crontab{
 		jobs:        make(map[string]Job),
+		nexts:       make(map[string]time.Time),
 		commandChan: make(chan *command),
-		ticker:      time.NewTicker(freq),
+		freq:        freq,
+		historySize: 10,
+		states:      make(map[string]*jobState),
+		clock:       clock.Real(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
-	c.loop = loop.GoRecoverable(c.backendLoop, c.checkRecovering)
+	if !c.sleepMode {
+		c.ticker = c.clock.NewTicker(freq)
+	}
+	c.loop = loop.GoRecoverable(c.backendLoop, c.checkRecovering, loop.WithClock(c.clock))
 	return c
 }
 
@@ -198,36 +248,157 @@ func (c *Crontab) Stop() error {
 	return c.loop.Stop()
 }
 
-// Add adds a new job to the server.
-func (c *Crontab) Add(id string, job Job) {
+// Wait blocks the caller until the cron server ended and returns
+// the error. This way a crontab can be a child of a supervisor.
+func (c *Crontab) Wait() error {
+	return c.loop.Wait()
+}
+
+// Add adds a new job to the server. Options like WithPolicy
+// configure its execution.
+func (c *Crontab) Add(id string, job Job, opts ...JobOption) {
+	c.register(id, opts)
 	c.commandChan <- &command{true, id, job}
 }
 
 // Remove removes a job from the server.
 func (c *Crontab) Remove(id string) {
+	c.unregister(id)
 	c.commandChan <- &command{false, id, nil}
 }
 
 // backendLoop runs the server backend.
 func (c *Crontab) backendLoop(l loop.Loop) error {
+	if c.sleepMode {
+		return c.sleepingLoop(l)
+	}
+	for {
+		select {
+		case <-l.ShallStop():
+			return nil
+		case cmd := <-c.commandChan:
+			if cmd.add {
+				c.jobs[cmd.id] = cmd.job
+				c.plan(cmd.id, cmd.job, c.clock.Now())
+			} else {
+				delete(c.jobs, cmd.id)
+				delete(c.nexts, cmd.id)
+			}
+		case now := <-c.ticker.C():
+			for id, job := range c.jobs {
+				if c.do(id, job, now) {
+					c.plan(id, job, now)
+				}
+			}
+		}
+	}
+}
+
+// sleepingLoop runs the server backend in sleep mode.
+func (c *Crontab) sleepingLoop(l loop.Loop) error {
+	now := c.clock.Now()
+	poll := c.poll(now)
+	for id, job := range c.jobs {
+		c.plan(id, job, now)
+	}
+	timer := c.clock.NewTimer(0)
+	defer timer.Stop()
 	for {
+		var timerChan <-chan time.Time
+		stopTimer(timer)
+		if wakeup, ok := c.wakeup(poll); ok {
+			timer.Reset(c.clock.Until(wakeup))
+			timerChan = timer.C()
+		}
 		select {
 		case <-l.ShallStop():
 			return nil
 		case cmd := <-c.commandChan:
 			if cmd.add {
 				c.jobs[cmd.id] = cmd.job
+				c.plan(cmd.id, cmd.job, c.clock.Now())
 			} else {
 				delete(c.jobs, cmd.id)
+				delete(c.nexts, cmd.id)
+			}
+		case now := <-timerChan:
+			polling := !poll.IsZero() && !now.Before(poll)
+			if polling {
+				poll = c.poll(now)
 			}
-		case now := <-c.ticker.C:
 			for id, job := range c.jobs {
-				c.do(id, job, now)
+				next, scheduled := c.nexts[id]
+				switch {
+				case scheduled && !next.IsZero() && !next.After(now):
+					c.do(id, job, next)
+					c.plan(id, job, now)
+				case !scheduled && polling:
+					c.do(id, job, now)
+				}
 			}
 		}
 	}
 }
 
+// poll returns the next time the jobs not implementing ScheduledJob
+// are checked in sleep mode. It is the zero time if polling is off.
+func (c *Crontab) poll(now time.Time) time.Time {
+	if c.freq <= 0 {
+		return time.Time{}
+	}
+	return now.Add(c.freq)
+}
+
+// plan sets the next execution time of a scheduled job. It
+// is the zero time if there are no more executions.
+func (c *Crontab) plan(id string, job Job, now time.Time) {
+	now = c.in(now)
+	if sj, ok := job.(ScheduledJob); ok {
+		c.nexts[id] = sj.Next(now)
+		c.scheduled(id, c.nexts[id])
+	}
+}
+
+// wakeup returns the time the sleeping backend has to wake up, the
+// poll time for unscheduled jobs or the nearest next execution. It
+// returns false if there's no need to wake up.
+func (c *Crontab) wakeup(poll time.Time) (time.Time, bool) {
+	var wakeup time.Time
+	found := false
+	for id := range c.jobs {
+		next, scheduled := c.nexts[id]
+		if !scheduled {
+			next = poll
+		}
+		if next.IsZero() {
+			continue
+		}
+		if !found || next.Before(wakeup) {
+			wakeup = next
+			found = true
+		}
+	}
+	return wakeup, found
+}
+
+// stopTimer stops a timer and drains its channel.
+func stopTimer(t clock.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C():
+		default:
+		}
+	}
+}
+
+// in converts the time into the location of the crontab if set.
+func (c *Crontab) in(t time.Time) time.Time {
+	if c.location == nil {
+		return t
+	}
+	return t.In(c.location)
+}
+
 // checkRecovering checks if the backend can be recovered.
 func (c *Crontab) checkRecovering(rs loop.Recoverings) (loop.Recoverings, error) {
 	if rs.Frequency(12, time.Minute) {
@@ -238,20 +409,14 @@ func (c *Crontab) checkRecovering(rs loop.Recoverings) (loop.Recoverings, error)
 	return rs.Trim(12), nil
 }
 
-// do checks and performs a job.
-func (c *Crontab) do(id string, job Job, now time.Time) {
-	if job.ShallExecute(now) {
-		go func() {
-			cont, err := job.Execute()
-			if err != nil {
-				logger.Errorf("job %q removed after error: %v", id, err)
-				cont = false
-			}
-			if !cont {
-				c.Remove(id)
-			}
-		}()
+// do checks and starts a job. It returns true if the
+// job shall be executed.
+func (c *Crontab) do(id string, job Job, now time.Time) bool {
+	if !job.ShallExecute(c.in(now)) {
+		return false
 	}
+	c.start(id, job)
+	return true
 }
 
 // EOF
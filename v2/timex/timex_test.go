@@ -16,6 +16,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tideland/goas/v1/clock"
+	"github.com/tideland/goas/v2/monitoring"
 	"github.com/tideland/goas/v2/timex"
 	"github.com/tideland/gots/v3/asserts"
 )
@@ -53,6 +55,267 @@ func TestTimeContainments(t *testing.T) {
 	assert.True(timex.WeekdayInRange(ts, time.Monday, time.Friday), "Go time in weekday range .")
 }
 
+// Test parsing invalid cron expressions.
+func TestParseScheduleErrors(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	tests := []struct {
+		expr    string
+		check   func(err error) bool
+		message string
+	}{
+		{"* * * *", timex.IsCronFieldCountError, `\[TIMEX:002\] cron expression .* has 4 fields .*`},
+		{"* * * * * * *", timex.IsCronFieldCountError, `\[TIMEX:002\] cron expression .* has 7 fields .*`},
+		{"@often", timex.IsUnknownCronMacroError, `\[TIMEX:003\] unknown cron macro "@often"`},
+		{"61 * * * *", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] minute value 61 is out of range 0-59`},
+		{"* 24 * * *", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] hour value 24 is out of range 0-23`},
+		{"* * * 13 *", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] month value 13 is out of range 1-12`},
+		{"* * * * FOO", timex.IsInvalidCronFieldError, `\[TIMEX:004\] invalid weekday field "FOO"`},
+		{"*/0 * * * *", timex.IsInvalidCronFieldError, `\[TIMEX:004\] invalid minute field "\*/0"`},
+		{"5-1 * * * *", timex.IsInvalidCronFieldError, `\[TIMEX:004\] invalid minute field "5-1"`},
+		{"1,,2 * * * *", timex.IsInvalidCronFieldError, `\[TIMEX:004\] invalid minute field "1,,2"`},
+		{"0 0 32W * *", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] day value 32 is out of range 1-31`},
+		{"0 0 L-x * *", timex.IsInvalidCronFieldError, `\[TIMEX:004\] invalid day field "L-x"`},
+		{"0 0 L-31 * *", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] day value 31 is out of range 0-30`},
+		{"0 0 * * 1#x", timex.IsInvalidCronFieldError, `\[TIMEX:004\] invalid weekday field "1#x"`},
+		{"0 0 * * 1#6", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] weekday value 6 is out of range 1-5`},
+		{"0 0 * * 8L", timex.IsCronValueOutOfRangeError, `\[TIMEX:005\] weekday value 8 is out of range 0-7`},
+	}
+	for _, test := range tests {
+		s, err := timex.ParseSchedule(test.expr)
+		assert.Nil(s, test.expr)
+		assert.True(test.check(err), test.expr)
+		assert.ErrorMatch(err, "^"+test.message+"$", test.expr)
+	}
+}
+
+// Test matching of times by schedules.
+func TestScheduleMatches(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	at := func(month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(2014, month, day, hour, minute, second, 0, time.UTC)
+	}
+	tests := []struct {
+		expr    string
+		time    time.Time
+		matches bool
+	}{
+		{"*/15 * * * *", at(time.January, 1, 12, 30, 0), true},
+		{"*/15 * * * *", at(time.January, 1, 12, 31, 0), false},
+		{"0 12 * * MON-FRI", at(time.January, 1, 12, 0, 0), true},
+		{"0 12 * * MON-FRI", at(time.January, 4, 12, 0, 0), false},
+		{"30 0 9 1,15 JAN *", at(time.January, 15, 9, 0, 30), true},
+		{"30 0 9 1,15 JAN *", at(time.January, 15, 9, 0, 0), false},
+		{"30 0 9 1,15 JAN *", at(time.February, 15, 9, 0, 30), false},
+		{"0 */6 * * *", at(time.January, 1, 18, 0, 59), true},
+		{"@daily", at(time.January, 2, 0, 0, 0), true},
+		{"@daily", at(time.January, 2, 0, 1, 0), false},
+		{"@hourly", at(time.January, 2, 5, 0, 0), true},
+		{"@weekly", at(time.January, 5, 0, 0, 0), true},
+		{"@yearly", at(time.January, 1, 0, 0, 0), true},
+		{"0 0 L * *", at(time.February, 28, 0, 0, 0), true},
+		{"0 0 L * *", at(time.February, 27, 0, 0, 0), false},
+		{"0 0 L-2 * *", at(time.January, 29, 0, 0, 0), true},
+		{"0 0 15W * *", at(time.March, 14, 0, 0, 0), true},
+		{"0 0 15W * *", at(time.March, 15, 0, 0, 0), false},
+		{"0 0 1W * *", at(time.February, 3, 0, 0, 0), true},
+		{"0 0 LW * *", at(time.May, 30, 0, 0, 0), true},
+		{"0 0 LW * *", at(time.May, 31, 0, 0, 0), false},
+		{"0 0 * * 5L", at(time.January, 31, 0, 0, 0), true},
+		{"0 0 * * 5L", at(time.January, 24, 0, 0, 0), false},
+		{"0 0 ? * FRI#2", at(time.January, 10, 0, 0, 0), true},
+		{"0 0 ? * FRI#2", at(time.January, 17, 0, 0, 0), false},
+		{"0 0 13 * FRI", at(time.January, 13, 0, 0, 0), true},
+		{"0 0 13 * FRI", at(time.January, 17, 0, 0, 0), true},
+		{"0 0 13 * FRI", at(time.January, 14, 0, 0, 0), false},
+		{"0 0 */2 * 1", at(time.January, 13, 0, 0, 0), true},
+		{"0 0 */2 * 1", at(time.January, 6, 0, 0, 0), false},
+		{"0 0 */2 * 1", at(time.January, 7, 0, 0, 0), false},
+		{"0 0 13 * */2", at(time.January, 14, 0, 0, 0), false},
+		{"0 0 * * 7", at(time.January, 5, 0, 0, 0), true},
+		{"0 0 * * 0", at(time.January, 6, 0, 0, 0), false},
+	}
+	for _, test := range tests {
+		s, err := timex.ParseSchedule(test.expr)
+		assert.Nil(err, test.expr)
+		assert.Equal(s.String(), test.expr)
+		assert.Equal(s.Matches(test.time), test.matches, test.expr, test.time.String())
+	}
+}
+
+// Test computing the next times of schedules.
+func TestScheduleNext(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	at := func(year int, month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	}
+	tests := []struct {
+		expr  string
+		after time.Time
+		next  time.Time
+	}{
+		{"* * * * *", at(2014, time.January, 1, 12, 0, 30), at(2014, time.January, 1, 12, 1, 0)},
+		{"* * * * * *", at(2014, time.January, 1, 12, 0, 30), at(2014, time.January, 1, 12, 0, 31)},
+		{"*/15 * * * *", at(2014, time.January, 1, 12, 0, 0), at(2014, time.January, 1, 12, 15, 0)},
+		{"0 12 * * MON-FRI", at(2014, time.January, 3, 12, 0, 0), at(2014, time.January, 6, 12, 0, 0)},
+		{"30 0 9 1,15 JAN *", at(2014, time.January, 15, 9, 0, 30), at(2015, time.January, 1, 9, 0, 30)},
+		{"@yearly", at(2014, time.June, 1, 0, 0, 0), at(2015, time.January, 1, 0, 0, 0)},
+		{"@monthly", at(2014, time.January, 31, 23, 59, 59), at(2014, time.February, 1, 0, 0, 0)},
+		{"0 0 L * *", at(2014, time.February, 1, 0, 0, 0), at(2014, time.February, 28, 0, 0, 0)},
+		{"0 0 LW * *", at(2014, time.May, 1, 0, 0, 0), at(2014, time.May, 30, 0, 0, 0)},
+		{"0 0 * * 5L", at(2014, time.January, 1, 0, 0, 0), at(2014, time.January, 31, 0, 0, 0)},
+		{"0 0 29 FEB *", at(2014, time.January, 1, 0, 0, 0), at(2016, time.February, 29, 0, 0, 0)},
+		{"0 0 30 FEB *", at(2014, time.January, 1, 0, 0, 0), time.Time{}},
+	}
+	for _, test := range tests {
+		s, err := timex.ParseSchedule(test.expr)
+		assert.Nil(err, test.expr)
+		assert.Equal(s.Next(test.after), test.next, test.expr)
+	}
+}
+
+// Test next executions on time zone transitions.
+func TestScheduleTimeZones(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.Nil(err)
+	at := func(month time.Month, day, hour, minute int, zone string) time.Time {
+		offset := map[string]int{"CET": 1, "CEST": 2}[zone]
+		return time.Date(2014, month, day, hour-offset, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr  string
+		after time.Time
+		next  time.Time
+	}{
+		// Clocks put forward on March 30th at 02:00 CET.
+		{"30 2 * * *", at(time.March, 29, 1, 0, "CET"), at(time.March, 29, 2, 30, "CET")},
+		{"30 2 * * *", at(time.March, 30, 1, 0, "CET"), at(time.March, 30, 3, 0, "CEST")},
+		{"30 2 * * *", at(time.March, 30, 3, 0, "CEST"), at(time.March, 31, 2, 30, "CEST")},
+		{"0 3 * * *", at(time.March, 30, 1, 0, "CET"), at(time.March, 30, 3, 0, "CEST")},
+		{"0 3 * * *", at(time.March, 30, 3, 0, "CEST"), at(time.March, 31, 3, 0, "CEST")},
+		{"*/30 * * * *", at(time.March, 30, 1, 30, "CET"), at(time.March, 30, 3, 0, "CEST")},
+		// Clocks put back on October 26th at 03:00 CEST.
+		{"30 2 * * *", at(time.October, 26, 1, 0, "CEST"), at(time.October, 26, 2, 30, "CEST")},
+		{"30 2 * * *", at(time.October, 26, 2, 30, "CEST"), at(time.October, 27, 2, 30, "CET")},
+		{"30 2 * * *", at(time.October, 26, 2, 0, "CET"), at(time.October, 27, 2, 30, "CET")},
+		{"*/30 * * * *", at(time.October, 26, 2, 30, "CEST"), at(time.October, 26, 2, 0, "CET")},
+		{"*/30 * * * *", at(time.October, 26, 2, 0, "CET"), at(time.October, 26, 2, 30, "CET")},
+	}
+	for _, test := range tests {
+		s, err := timex.ParseScheduleIn(test.expr, berlin)
+		assert.Nil(err, test.expr)
+		assert.Equal(s.Next(test.after).UTC(), test.next, test.expr)
+	}
+
+	// Time zone prefix takes precedence.
+	s, err := timex.ParseScheduleIn("CRON_TZ=Europe/Berlin 0 12 * * *", time.UTC)
+	assert.Nil(err)
+	assert.Equal(s.Location().String(), "Europe/Berlin")
+	assert.True(s.Matches(at(time.January, 1, 12, 0, "CET")))
+	assert.False(s.Matches(time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)))
+	_, err = timex.ParseSchedule("TZ=Nowhere/Atlantis 0 12 * * *")
+	assert.True(timex.IsUnknownTimeZoneError(err))
+}
+
+// Test daily cron jobs across time zone transitions.
+func TestCronJobTimeZones(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	tests := []struct {
+		start time.Time
+		days  []int
+	}{
+		{time.Date(2014, time.March, 28, 0, 0, 0, 0, time.UTC), []int{28, 29, 30, 31, 1}},
+		{time.Date(2014, time.October, 24, 0, 0, 0, 0, time.UTC), []int{24, 25, 26, 27, 28}},
+	}
+	for _, test := range tests {
+		// Checked every minute from two days before the
+		// transition up to two days after it.
+		executions := 0
+		j, err := timex.NewCronJob("TZ=Europe/Berlin 30 2 * * *", func() (bool, error) {
+			executions++
+			return true, nil
+		})
+		assert.Nil(err)
+		var days []int
+		for now := test.start; now.Before(test.start.AddDate(0, 0, 5)); now = now.Add(time.Minute) {
+			if j.ShallExecute(now) {
+				days = append(days, now.Day())
+				j.Execute()
+			}
+		}
+		assert.Equal(executions, 5)
+		assert.Equal(days, test.days)
+	}
+}
+
+// Test a crontab in sleep mode.
+func TestCrontabSleepMode(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	start := time.Date(2014, time.January, 1, 12, 30, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	c := timex.NewCrontab(time.Second, timex.WithClock(clk), timex.WithSleepMode())
+	j := &hourlyjob{make(chan time.Time, 1)}
+
+	// Sleeping until the next full hour.
+	c.Add("hourly", j)
+	for i := 1; i <= 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Hour)
+		assert.Equal(<-j.checks, start.Add(time.Duration(i)*time.Hour-30*time.Minute), "checked at the next full hour")
+	}
+	assert.Nil(c.Stop())
+
+	// Polling unscheduled jobs.
+	c = timex.NewCrontab(time.Minute, timex.WithClock(clk), timex.WithSleepMode())
+	cj := &clockjob{make(chan time.Time, 1)}
+	c.Add("clock", cj)
+	clk.BlockUntil(1)
+	now := clk.Now()
+	clk.Advance(time.Minute)
+	assert.Equal(<-cj.checks, now.Add(time.Minute), "checked after the frequency")
+	assert.Nil(c.Stop())
+
+	// No polling without a frequency.
+	c = timex.NewCrontab(0, timex.WithClock(clk), timex.WithSleepMode())
+	cj = &clockjob{make(chan time.Time, 100)}
+	c.Add("clock", cj)
+	c.Add("hourly", j)
+	now = clk.Now()
+	for i := 1; i <= 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Hour)
+		assert.Equal(<-j.checks, now.Truncate(time.Hour).Add(time.Duration(i)*time.Hour), "checked at the next full hour")
+	}
+	assert.Nil(c.Stop())
+	assert.Length(cj.checks, 0, "unscheduled job never polled")
+}
+
+// Test a job created out of a cron expression.
+func TestCronJob(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	executed := 0
+	j, err := timex.NewCronJob("* * * * *", func() (bool, error) {
+		executed++
+		return true, nil
+	})
+	assert.Nil(err)
+
+	// Checked every ten seconds, executed once per minute.
+	start := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 18; i++ {
+		now := start.Add(time.Duration(i) * 10 * time.Second)
+		if j.ShallExecute(now) {
+			cont, err := j.Execute()
+			assert.True(cont)
+			assert.Nil(err)
+		}
+	}
+	assert.Equal(executed, 3)
+
+	_, err = timex.NewCronJob("@often", nil)
+	assert.True(timex.IsUnknownCronMacroError(err))
+}
+
 // Test crontab keeping the job.
 func TestCrontabKeep(t *testing.T) {
 	assert := asserts.NewTestingAssertion(t, true)
@@ -98,6 +361,153 @@ func TestCrontabError(t *testing.T) {
 	assert.Equal(j.counter, 5, "job counter increased max five times")
 }
 
+// Test crontab with a fake clock.
+func TestCrontabClock(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	start := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	c := timex.NewCrontab(time.Minute, timex.WithClock(clk))
+	j := &clockjob{make(chan time.Time, 1)}
+
+	c.Add("clock", j)
+	for i := 1; i <= 3; i++ {
+		clk.Advance(time.Minute)
+		assert.Equal(<-j.checks, start.Add(time.Duration(i)*time.Minute), "checked at the fake time")
+	}
+	assert.Nil(c.Stop())
+}
+
+// Test the status and history of crontab jobs.
+func TestCrontabStatus(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	assert.Nil(monitoring.Reset())
+	start := time.Date(2014, time.January, 1, 12, 0, 30, 0, time.UTC)
+	clk := clock.NewFake(start)
+	c := timex.NewCrontab(time.Minute, timex.WithClock(clk), timex.WithSleepMode(),
+		timex.WithHistory(2), timex.WithMonitoring("status"))
+	executed := make(chan struct{}, 1)
+	j, err := timex.NewCronJob("* * * * *", func() (bool, error) {
+		executed <- struct{}{}
+		return true, nil
+	})
+	assert.Nil(err)
+
+	c.Add("minutely", j)
+	status, err := c.Job("minutely")
+	assert.Nil(err)
+	assert.Equal(status.Runs, 0)
+	clk.BlockUntil(1)
+	clk.Advance(30 * time.Second)
+	<-executed
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+		<-executed
+	}
+
+	// Runs are recorded after the execution.
+	status = waitStatus(c, "minutely", func(s *timex.JobStatus) bool {
+		return s.Runs == 3 && s.Next.Equal(start.Add(210*time.Second))
+	})
+	assert.NotNil(status, "status after three runs")
+	assert.Equal(status.LastStart, start.Add(150*time.Second))
+	assert.Nil(status.LastError)
+	assert.Length(status.History, 2)
+	assert.Equal(status.History[0].Start, start.Add(90*time.Second))
+	assert.Equal(status.History[1].Start, start.Add(150*time.Second))
+	assert.Length(c.Jobs(), 1)
+	mp, err := monitoring.ReadMeasuringPoint("status::minutely")
+	assert.Nil(err)
+	assert.Equal(mp.Count, int64(3))
+
+	c.Remove("minutely")
+	_, err = c.Job("minutely")
+	assert.True(timex.IsJobNotFoundError(err))
+	assert.Length(c.Jobs(), 0)
+	assert.Nil(c.Stop())
+}
+
+// Test the concurrency policies of crontab jobs.
+func TestCrontabPolicies(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	clk := clock.NewFake(time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC))
+	c := timex.NewCrontab(time.Minute, timex.WithClock(clk))
+	tick := func(id string, cond func(s *timex.JobStatus) bool) *timex.JobStatus {
+		clk.Advance(time.Minute)
+		return waitStatus(c, id, cond)
+	}
+
+	// Skipping while running.
+	skip := &blockingjob{make(chan struct{}, 10), make(chan struct{})}
+	c.Add("skip", skip, timex.WithPolicy(timex.SkipIfRunning))
+	assert.NotNil(tick("skip", func(s *timex.JobStatus) bool { return s.Running == 1 }))
+	assert.NotNil(tick("skip", func(s *timex.JobStatus) bool { return s.Skipped == 1 }))
+	skip.release <- struct{}{}
+	assert.NotNil(waitStatus(c, "skip", func(s *timex.JobStatus) bool { return s.Running == 0 && s.Runs == 1 }))
+	c.Remove("skip")
+
+	// Queueing one execution.
+	queue := &blockingjob{make(chan struct{}, 10), make(chan struct{})}
+	c.Add("queue", queue, timex.WithPolicy(timex.QueueOne))
+	assert.NotNil(tick("queue", func(s *timex.JobStatus) bool { return s.Running == 1 }))
+	assert.NotNil(tick("queue", func(s *timex.JobStatus) bool { return s.Queued }))
+	assert.NotNil(tick("queue", func(s *timex.JobStatus) bool { return s.Skipped == 1 }))
+	queue.release <- struct{}{}
+	assert.NotNil(waitStatus(c, "queue", func(s *timex.JobStatus) bool { return s.Running == 1 && !s.Queued && s.Runs == 1 }))
+	queue.release <- struct{}{}
+	assert.NotNil(waitStatus(c, "queue", func(s *timex.JobStatus) bool { return s.Running == 0 && s.Runs == 2 }))
+	c.Remove("queue")
+
+	// Replacing the running execution.
+	replace := &blockingjob{make(chan struct{}, 10), make(chan struct{})}
+	c.Add("replace", replace, timex.WithPolicy(timex.ReplaceRunning))
+	assert.NotNil(tick("replace", func(s *timex.JobStatus) bool { return s.Running == 1 }))
+	assert.NotNil(tick("replace", func(s *timex.JobStatus) bool { return s.Running == 1 && s.Runs == 1 }))
+	replace.release <- struct{}{}
+	status := waitStatus(c, "replace", func(s *timex.JobStatus) bool { return s.Running == 0 && s.Runs == 2 })
+	assert.NotNil(status)
+	assert.Equal(status.Skipped, 0)
+	assert.Nil(c.Stop())
+}
+
+// Test the limit of concurrently executing jobs.
+func TestCrontabMaxRunning(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	clk := clock.NewFake(time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC))
+	c := timex.NewCrontab(time.Minute, timex.WithClock(clk), timex.WithMaxRunning(1))
+	executing := make(chan struct{}, 2)
+	first := &blockingjob{executing, make(chan struct{})}
+	second := &blockingjob{executing, make(chan struct{})}
+	c.Add("first", first)
+	c.Add("second", second)
+
+	// Both are started, but only one executes.
+	clk.Advance(time.Minute)
+	<-executing
+	running, waiting := 0, 0
+	for _, id := range []string{"first", "second"} {
+		status := waitStatus(c, id, func(s *timex.JobStatus) bool { return s.Running+s.Waiting == 1 })
+		assert.NotNil(status)
+		running += status.Running
+		waiting += status.Waiting
+	}
+	assert.Equal(running, 1, "one job executes")
+	assert.Equal(waiting, 1, "other job waits for a free slot")
+	assert.Equal(len(executing), 0, "waiting job does not execute")
+	select {
+	case first.release <- struct{}{}:
+		<-executing
+		second.release <- struct{}{}
+	case second.release <- struct{}{}:
+		<-executing
+		first.release <- struct{}{}
+	}
+	for _, id := range []string{"first", "second"} {
+		assert.NotNil(waitStatus(c, id, func(s *timex.JobStatus) bool { return s.Running == 0 && s.Waiting == 0 && s.Runs == 1 }))
+	}
+	assert.Nil(c.Stop())
+}
+
 //--------------------
 // HELPERS
 //--------------------
@@ -124,4 +534,70 @@ func (j *cronjob) Execute() (bool, error) {
 	return true, nil
 }
 
+// hourlyjob is a scheduled job reporting the times it is
+// checked with.
+type hourlyjob struct {
+	checks chan time.Time
+}
+
+func (j *hourlyjob) ShallExecute(t time.Time) bool {
+	j.checks <- t
+	return true
+}
+
+func (j *hourlyjob) Execute() (bool, error) {
+	return true, nil
+}
+
+func (j *hourlyjob) Next(t time.Time) time.Time {
+	return t.Truncate(time.Hour).Add(time.Hour)
+}
+
+// clockjob reports the times it is checked with.
+type clockjob struct {
+	checks chan time.Time
+}
+
+func (j *clockjob) ShallExecute(t time.Time) bool {
+	j.checks <- t
+	return false
+}
+
+func (j *clockjob) Execute() (bool, error) {
+	return true, nil
+}
+
+// blockingjob signals its executions and blocks them until
+// they are released or canceled.
+type blockingjob struct {
+	executing chan struct{}
+	release   chan struct{}
+}
+
+func (j *blockingjob) ShallExecute(t time.Time) bool {
+	return true
+}
+
+func (j *blockingjob) Execute() (bool, error) {
+	j.executing <- struct{}{}
+	<-j.release
+	return true, nil
+}
+
+func (j *blockingjob) Cancel() {
+	j.release <- struct{}{}
+}
+
+// waitStatus waits until the status of a job fulfills the
+// condition and returns it, or nil after a timeout.
+func waitStatus(c *timex.Crontab, id string, cond func(s *timex.JobStatus) bool) *timex.JobStatus {
+	for i := 0; i < 100; i++ {
+		if s, err := c.Job(id); err == nil && cond(s) {
+			return s
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
 // EOF
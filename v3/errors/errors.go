@@ -187,20 +187,21 @@ type callInfo struct {
 func retrieveCallInfo() *callInfo {
 	pc, file, line, _ := runtime.Caller(3)
 	_, fileName := path.Split(file)
-	parts := strings.Split(runtime.FuncForPC(pc).Name(), ".")
-	pl := len(parts)
-	packageName := ""
-	funcName := parts[pl-1]
-
-	if parts[pl-2][0] == '(' {
-		funcName = parts[pl-2] + "." + funcName
-		packageName = strings.Join(parts[0:pl-2], ".")
-	} else {
-		packageName = strings.Join(parts[0:pl-1], ".")
+	// The package name ends with the first dot after the last slash,
+	// dots inside the last path element are escaped. So the rest like
+	// receivers, type parameters, or closures is the function name.
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndex(name, "/") + 1
+	dot := strings.Index(name[slash:], ".")
+	packageName := name
+	funcName := ""
+
+	if dot >= 0 {
+		packageName = name[:slash+dot]
+		funcName = name[slash+dot+1:]
 	}
 
-	packageParts := strings.Split(packageName, "/")
-	packagePart := strings.ToUpper(packageParts[len(packageParts)-1])
+	packagePart := strings.ToUpper(packageName[slash:])
 
 	return &callInfo{
 		packageName: packageName,
@@ -72,6 +72,29 @@ func TestIsError(t *testing.T) {
 	assert.False(errors.IsError(err, 0))
 }
 
+// Test the package of errors created in closures and generic methods.
+func TestCallInfo(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+
+	ec := 7
+	messages := errors.Messages{ec: "call info"}
+	err := func() error {
+		return errors.New(ec, messages)
+	}()
+	packageName, _, _, lerr := errors.Location(err)
+
+	assert.Nil(lerr)
+	assert.Equal(packageName, "github.com/tideland/goas/v3/errors_test")
+	assert.ErrorMatch(err, `^\[ERRORS_TEST:007\] call info$`)
+
+	err = (&testBox[int]{}).fail(ec, messages)
+	packageName, _, _, lerr = errors.Location(err)
+
+	assert.Nil(lerr)
+	assert.Equal(packageName, "github.com/tideland/goas/v3/errors_test")
+	assert.ErrorMatch(err, `^\[ERRORS_TEST:007\] call info$`)
+}
+
 //--------------------
 // HELPERS
 //--------------------
@@ -82,4 +105,10 @@ func (e testError) Error() string {
 	return string(e)
 }
 
+type testBox[T any] struct{}
+
+func (b *testBox[T]) fail(ec int, messages errors.Messages) error {
+	return errors.New(ec, messages)
+}
+
 // EOF
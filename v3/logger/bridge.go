@@ -0,0 +1,290 @@
+// Tideland Go Application Support - Logger - Bridges
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package logger
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+//--------------------
+// LOG WRITER
+//--------------------
+
+// bridgePackages are the packages skipped when looking for the
+// caller of a bridged log statement.
+var bridgePackages = map[string]bool{
+	"fmt":      true,
+	"log":      true,
+	"log/slog": true,
+}
+
+// logWriter is the writer for the bridge from the log package.
+type logWriter struct {
+	level LogLevel
+}
+
+// NewWriter returns a writer logging each write as one message with
+// the passed level. It's intended as output of the standard log
+// package, e.g. by log.SetOutput(logger.NewWriter(logger.LevelInfo)).
+// The call info is the one of the caller of the log package. As the
+// backend adds the time, the log flags should be set to 0.
+func NewWriter(level LogLevel) io.Writer {
+	return &logWriter{validLevel(level)}
+}
+
+// Write is specified on the io.Writer interface.
+func (lw *logWriter) Write(p []byte) (int, error) {
+	logEntry(&Record{
+		Time:    time.Now(),
+		Level:   lw.level,
+		Message: strings.TrimSuffix(string(p), "\n"),
+		info:    bridgeCallInfo(),
+	})
+	return len(p), nil
+}
+
+// bridgeCallInfo returns the call info of the first caller outside
+// of the logging packages.
+func bridgeCallInfo() *callInfo {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		pkg, _ := splitFuncName(frame.Function)
+		if !bridgePackages[pkg] && pkg != thisPackage && !isHelper(frame.Function) {
+			return callInfoForFrame(frame)
+		}
+		if !more {
+			return &callInfo{}
+		}
+	}
+}
+
+// thisPackage is the name of the logger package.
+var thisPackage = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	pkg, _ := splitFuncName(runtime.FuncForPC(pc).Name())
+	return pkg
+}()
+
+//--------------------
+// SLOG HANDLER
+//--------------------
+
+// slogHandler is the slog.Handler for the bridge from the slog package.
+type slogHandler struct {
+	attrs string
+	group string
+}
+
+// NewSlogHandler returns a slog.Handler routing the slog records into
+// the logger. The slog levels are mapped to the log levels debug, info,
+// warning, error, and critical, the attributes are appended to the
+// message as key/value pairs.
+func NewSlogHandler() slog.Handler {
+	return &slogHandler{}
+}
+
+// Enabled is specified on the slog.Handler interface.
+func (sh *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	logMux.Lock()
+	defer logMux.Unlock()
+	min := logLevel
+	for _, plevel := range logPackageLevels {
+		if plevel < min {
+			min = plevel
+		}
+	}
+	return fromSlogLevel(level) >= min
+}
+
+// Handle is specified on the slog.Handler interface.
+func (sh *slogHandler) Handle(ctx context.Context, sr slog.Record) error {
+	msg := sr.Message + sh.attrs
+	sr.Attrs(func(attr slog.Attr) bool {
+		msg += formatAttr(sh.group, attr)
+		return true
+	})
+	r := &Record{
+		Time:    sr.Time,
+		Level:   fromSlogLevel(sr.Level),
+		Message: msg,
+		pc:      sr.PC,
+		ctx:     ctx,
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.pc == 0 {
+		r.info = &callInfo{}
+	}
+
+	logEntry(r)
+	return nil
+}
+
+// WithAttrs is specified on the slog.Handler interface.
+func (sh *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h := &slogHandler{
+		attrs: sh.attrs,
+		group: sh.group,
+	}
+	for _, attr := range attrs {
+		h.attrs += formatAttr(sh.group, attr)
+	}
+	return h
+}
+
+// WithGroup is specified on the slog.Handler interface.
+func (sh *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return sh
+	}
+	return &slogHandler{
+		attrs: sh.attrs,
+		group: sh.group + name + ".",
+	}
+}
+
+// formatAttr returns an attribute as " key=value", groups are
+// flattened with dotted keys.
+func formatAttr(group string, attr slog.Attr) string {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		prefix := group
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		s := ""
+		for _, gattr := range value.Group() {
+			s += formatAttr(prefix, gattr)
+		}
+		return s
+	}
+	if attr.Key == "" {
+		return ""
+	}
+	return " " + group + attr.Key + "=" + logfmtValue(value.String())
+}
+
+//--------------------
+// SLOG LOGGER
+//--------------------
+
+// SlogLogger is a logger backend passing the log statements
+// to a slog.Handler. It must not be used with a handler routing
+// back into the logger.
+type SlogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger returns a logger passing the log statements to the
+// handler. The call info is added as attributes package, file, func,
+// and line.
+func NewSlogLogger(h slog.Handler) Logger {
+	return &SlogLogger{h}
+}
+
+// Debug is specified on the Logger interface.
+func (sl *SlogLogger) Debug(info, msg string) {
+	sl.LogRecord(newRecord(LevelDebug, parseCallInfo(info), msg))
+}
+
+// Info is specified on the Logger interface.
+func (sl *SlogLogger) Info(info, msg string) {
+	sl.LogRecord(newRecord(LevelInfo, parseCallInfo(info), msg))
+}
+
+// Warning is specified on the Logger interface.
+func (sl *SlogLogger) Warning(info, msg string) {
+	sl.LogRecord(newRecord(LevelWarning, parseCallInfo(info), msg))
+}
+
+// Error is specified on the Logger interface.
+func (sl *SlogLogger) Error(info, msg string) {
+	sl.LogRecord(newRecord(LevelError, parseCallInfo(info), msg))
+}
+
+// Critical is specified on the Logger interface.
+func (sl *SlogLogger) Critical(info, msg string) {
+	sl.LogRecord(newRecord(LevelCritical, parseCallInfo(info), msg))
+}
+
+// Fatal is specified on the Logger interface.
+func (sl *SlogLogger) Fatal(info, msg string) {
+	sl.LogRecord(newRecord(LevelFatal, parseCallInfo(info), msg))
+}
+
+// LogRecord is specified on the RecordLogger interface.
+func (sl *SlogLogger) LogRecord(r *Record) {
+	ctx := context.Background()
+	level := toSlogLevel(r.Level)
+	if !sl.handler.Enabled(ctx, level) {
+		return
+	}
+	sr := slog.NewRecord(r.Time, level, r.Message, 0)
+	sr.AddAttrs(slog.String("package", r.Package()))
+	if r.File() != "" {
+		sr.AddAttrs(
+			slog.String("file", r.File()),
+			slog.String("func", r.Func()),
+			slog.Int("line", r.Line()),
+		)
+	}
+	sl.handler.Handle(ctx, sr)
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// fromSlogLevel maps a slog level to a log level.
+func fromSlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarning
+	case level < slog.LevelError+4:
+		return LevelError
+	default:
+		return LevelCritical
+	}
+}
+
+// toSlogLevel maps a log level to a slog level.
+func toSlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarning:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	case LevelCritical:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelError + 8
+	}
+}
+
+// EOF
@@ -17,7 +17,7 @@ import "github.com/tideland/goas/v1/version"
 
 // PackageVersion returns the version of the version package.
 func PackageVersion() version.Version {
-	return version.New(3, 0, 1)
+	return version.New(3, 7, 0)
 }
 
 // EOF
@@ -0,0 +1,48 @@
+// Tideland Go Application Support - Logger
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package logger
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+const (
+	ErrInvalidLevel = iota + 1
+	ErrInvalidQuery
+)
+
+var errorMessages = errors.Messages{
+	ErrInvalidLevel: "invalid log level %q",
+	ErrInvalidQuery: "invalid query parameter %q",
+}
+
+//--------------------
+// TESTING
+//--------------------
+
+// IsInvalidLevelError returns true, if the error signals that
+// a log level name cannot be parsed.
+func IsInvalidLevelError(err error) bool {
+	return errors.IsError(err, ErrInvalidLevel)
+}
+
+// IsInvalidQueryError returns true, if the error signals that
+// a query parameter of the control handler is invalid.
+func IsInvalidQueryError(err error) bool {
+	return errors.IsError(err, ErrInvalidQuery)
+}
+
+// EOF
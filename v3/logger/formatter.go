@@ -0,0 +1,244 @@
+// Tideland Go Application Support - Logger - Formatter
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package logger
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//--------------------
+// FORMATTER
+//--------------------
+
+// timeFormat controls how the timestamp of the standard logger is printed.
+const timeFormat = "2006-01-02 15:04:05 Z07:00"
+
+// Formatter creates the line written by a StandardLogger
+// for a record, without the trailing newline.
+type Formatter interface {
+	// Format returns the formatted record.
+	Format(r *Record) string
+}
+
+// FormatterFunc allows to use a simple function as Formatter.
+type FormatterFunc func(r *Record) string
+
+// Format is specified on the Formatter interface.
+func (ff FormatterFunc) Format(r *Record) string {
+	return ff(r)
+}
+
+// recordTime returns the time of the record in UTC or local time.
+func recordTime(r *Record, utc bool) time.Time {
+	if utc {
+		return r.Time.UTC()
+	}
+	return r.Time.Local()
+}
+
+//--------------------
+// TEXT FORMATTER
+//--------------------
+
+// textFormatter writes records in the layout "time [LEVEL] info message".
+type textFormatter struct {
+	timeFormat string
+	utc        bool
+}
+
+// NewTextFormatter returns a formatter writing the records in the
+// layout "time [LEVEL] info message" as used by NewStandardLogger().
+// An empty time format leads to the default one. The time is
+// written in UTC or local time.
+func NewTextFormatter(timeFormat string, utc bool) Formatter {
+	return &textFormatter{
+		timeFormat: defaultTimeFormat(timeFormat),
+		utc:        utc,
+	}
+}
+
+// Format is specified on the Formatter interface.
+func (tf *textFormatter) Format(r *Record) string {
+	return recordTime(r, tf.utc).Format(tf.timeFormat) + " [" + r.Level.String() + "] " + r.Info() + " " + r.Message
+}
+
+//--------------------
+// LOGFMT FORMATTER
+//--------------------
+
+// logfmtFormatter writes records as key/value pairs.
+type logfmtFormatter struct {
+	utc bool
+}
+
+// NewLogfmtFormatter returns a formatter writing the records as
+// logfmt key/value pairs with the keys time, level, package, file,
+// func, line, and msg. The time is written as RFC 3339 in UTC or
+// local time.
+func NewLogfmtFormatter(utc bool) Formatter {
+	return &logfmtFormatter{utc}
+}
+
+// Format is specified on the Formatter interface.
+func (lf *logfmtFormatter) Format(r *Record) string {
+	pairs := []string{
+		"time=" + recordTime(r, lf.utc).Format(time.RFC3339),
+		"level=" + strings.ToLower(r.Level.String()),
+		"package=" + logfmtValue(r.Package()),
+	}
+	if r.File() != "" {
+		pairs = append(pairs,
+			"file="+logfmtValue(r.File()),
+			"func="+logfmtValue(r.Func()),
+			"line="+strconv.Itoa(r.Line()))
+	}
+	pairs = append(pairs, "msg="+logfmtValue(r.Message))
+	return strings.Join(pairs, " ")
+}
+
+// logfmtValue quotes a value if needed.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+//--------------------
+// TEMPLATE FORMATTER
+//--------------------
+
+// TemplateData is passed to the template of a template formatter.
+// Time is already formatted.
+type TemplateData struct {
+	Time    string
+	Level   string
+	Package string
+	File    string
+	Func    string
+	Line    int
+	Info    string
+	Message string
+}
+
+// templateFormatter writes records based on a text template.
+type templateFormatter struct {
+	template   *template.Template
+	timeFormat string
+	utc        bool
+}
+
+// NewTemplateFormatter returns a formatter writing the records using
+// the passed text template. Placeholders are the fields of TemplateData,
+// e.g. "{{.Time}} {{.Level}} {{.Package}}:{{.Line}} {{.Message}}". An
+// empty time format leads to the default one.
+func NewTemplateFormatter(text, timeFormat string, utc bool) (Formatter, error) {
+	tmpl, err := template.New("record").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &templateFormatter{
+		template:   tmpl,
+		timeFormat: defaultTimeFormat(timeFormat),
+		utc:        utc,
+	}, nil
+}
+
+// Format is specified on the Formatter interface.
+func (tf *templateFormatter) Format(r *Record) string {
+	td := &TemplateData{
+		Time:    recordTime(r, tf.utc).Format(tf.timeFormat),
+		Level:   r.Level.String(),
+		Package: r.Package(),
+		File:    r.File(),
+		Func:    r.Func(),
+		Line:    r.Line(),
+		Info:    r.Info(),
+		Message: r.Message,
+	}
+	var buf bytes.Buffer
+	if err := tf.template.Execute(&buf, td); err != nil {
+		return "template error: " + err.Error() + ": " + r.Message
+	}
+	return buf.String()
+}
+
+//--------------------
+// COLOR FORMATTER
+//--------------------
+
+// levelColors contains the ANSI color codes for the levels.
+var levelColors = map[LogLevel]string{
+	LevelDebug:    "\x1b[36m",
+	LevelInfo:     "\x1b[32m",
+	LevelWarning:  "\x1b[33m",
+	LevelError:    "\x1b[31m",
+	LevelCritical: "\x1b[35m",
+	LevelFatal:    "\x1b[1;31m",
+}
+
+// colorReset resets the ANSI color.
+const colorReset = "\x1b[0m"
+
+// colorFormatter colors the lines of another formatter.
+type colorFormatter struct {
+	formatter Formatter
+}
+
+// NewColorFormatter returns a formatter coloring the lines of the passed
+// formatter with ANSI colors depending on the level. This only happens
+// if out is a terminal, otherwise the passed formatter is returned.
+func NewColorFormatter(f Formatter, out io.Writer) Formatter {
+	if !IsTerminal(out) {
+		return f
+	}
+	return &colorFormatter{f}
+}
+
+// Format is specified on the Formatter interface.
+func (cf *colorFormatter) Format(r *Record) string {
+	return levelColors[validLevel(r.Level)] + cf.formatter.Format(r) + colorReset
+}
+
+// IsTerminal checks if the writer is a terminal.
+func IsTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+//--------------------
+// HELPER
+//--------------------
+
+// defaultTimeFormat returns the default time format if the
+// passed one is empty.
+func defaultTimeFormat(format string) string {
+	if format == "" {
+		return timeFormat
+	}
+	return format
+}
+
+// EOF
@@ -0,0 +1,199 @@
+// Tideland Go Application Support - Logger - Control Handler
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package logger
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tideland/goas/v3/errors"
+)
+
+//--------------------
+// CONTROL HANDLER
+//--------------------
+
+// controlStatus is the response of the control handler
+// describing the current log control.
+type controlStatus struct {
+	Level    string            `json:"level"`
+	Packages map[string]string `json:"packages"`
+	Backends []string          `json:"backends"`
+}
+
+// controlRecord is the response representation of a record.
+type controlRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Package string    `json:"package"`
+	File    string    `json:"file,omitempty"`
+	Func    string    `json:"func,omitempty"`
+	Line    int       `json:"line,omitempty"`
+	Message string    `json:"message"`
+}
+
+// controlHandler implements the control handler.
+type controlHandler struct {
+	ringLogger *RingLogger
+}
+
+// NewControlHandler returns a handler allowing the runtime control
+// of the logging via HTTP, e.g. when mounted on an admin mux. All
+// responses are JSON encoded.
+//
+// A GET returns the global level, the individual package levels and
+// the active backends. A PUT or POST sets the level passed as form
+// value "level", globally or for the package passed as form value
+// "package". A DELETE removes the level of the passed package.
+//
+// A GET of the path ending with "/records" returns the records of
+// the passed ring logger. They can be filtered by the query values
+// "level", "package", "from" and "to" (both RFC 3339) and limited
+// to the last "limit" ones. Without a ring logger the path is not
+// found.
+func NewControlHandler(rl *RingLogger) http.Handler {
+	return &controlHandler{rl}
+}
+
+// ServeHTTP is specified on the http.Handler interface.
+func (ch *controlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/records") {
+		ch.serveRecords(w, r)
+		return
+	}
+	switch r.Method {
+	case "GET":
+	case "PUT", "POST":
+		if err := ch.setLevel(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "DELETE":
+		pkg := r.FormValue("package")
+		if pkg == "" {
+			http.Error(w, "missing package", http.StatusBadRequest)
+			return
+		}
+		UnsetPackageLevel(pkg)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cs := &controlStatus{
+		Level:    Level().String(),
+		Packages: make(map[string]string),
+	}
+	for pkg, level := range PackageLevels() {
+		cs.Packages[pkg] = level.String()
+	}
+	for _, backend := range Backends() {
+		cs.Backends = append(cs.Backends, fmt.Sprintf("%T", backend))
+	}
+	writeJSON(w, cs)
+}
+
+// setLevel sets the global or package level passed with the request.
+func (ch *controlHandler) setLevel(r *http.Request) error {
+	level, err := ParseLevel(r.FormValue("level"))
+	if err != nil {
+		return err
+	}
+	if pkg := r.FormValue("package"); pkg != "" {
+		SetPackageLevel(pkg, level)
+	} else {
+		SetLevel(level)
+	}
+	return nil
+}
+
+// serveRecords returns the records of the ring logger.
+func (ch *controlHandler) serveRecords(w http.ResponseWriter, r *http.Request) {
+	if ch.ringLogger == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filters, limit, err := recordsQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rs := ch.ringLogger.Records(filters...)
+	if limit > 0 && limit < len(rs) {
+		rs = rs[len(rs)-limit:]
+	}
+	crs := []*controlRecord{}
+	for _, rec := range rs {
+		crs = append(crs, &controlRecord{
+			Time:    rec.Time,
+			Level:   rec.Level.String(),
+			Package: rec.Package(),
+			File:    rec.File(),
+			Func:    rec.Func(),
+			Line:    rec.Line(),
+			Message: rec.Message,
+		})
+	}
+	writeJSON(w, crs)
+}
+
+// recordsQuery reads the filters and the limit of a records query.
+func recordsQuery(r *http.Request) ([]RecordFilter, int, error) {
+	filters := []RecordFilter{}
+	if name := r.FormValue("level"); name != "" {
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		filters = append(filters, LevelFilter(level))
+	}
+	if pkg := r.FormValue("package"); pkg != "" {
+		filters = append(filters, PackageFilter(pkg))
+	}
+	var window [2]time.Time
+	for i, key := range []string{"from", "to"} {
+		if value := r.FormValue(key); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, 0, errors.Annotate(err, ErrInvalidQuery, errorMessages, key)
+			}
+			window[i] = t
+		}
+	}
+	filters = append(filters, TimeFilter(window[0], window[1]))
+	limit := 0
+	if value := r.FormValue("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, 0, errors.Annotate(err, ErrInvalidQuery, errorMessages, "limit")
+		}
+		limit = l
+	}
+	return filters, limit, nil
+}
+
+// writeJSON writes the value JSON encoded as response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// EOF
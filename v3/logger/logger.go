@@ -12,15 +12,20 @@ package logger
 //--------------------
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tideland/goas/v3/errors"
 )
 
 //--------------------
@@ -41,14 +46,52 @@ const (
 	LevelFatal
 )
 
+// String returns the name of the log level.
+func (ll LogLevel) String() string {
+	switch {
+	case ll <= LevelDebug:
+		return "DEBUG"
+	case ll == LevelInfo:
+		return "INFO"
+	case ll == LevelWarning:
+		return "WARNING"
+	case ll == LevelError:
+		return "ERROR"
+	case ll == LevelCritical:
+		return "CRITICAL"
+	default:
+		return "FATAL"
+	}
+}
+
+// ParseLevel returns the log level for the passed name. It's
+// the opposite of LogLevel.String() but ignores the case.
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARNING":
+		return LevelWarning, nil
+	case "ERROR":
+		return LevelError, nil
+	case "CRITICAL":
+		return LevelCritical, nil
+	case "FATAL":
+		return LevelFatal, nil
+	}
+	return LevelInfo, errors.New(ErrInvalidLevel, errorMessages, name)
+}
+
 // FatalExiterFunc defines a functions that will be called
 // in case of a Fatalf call.
 type FatalExiterFunc func()
 
 // OsFatalExiter exits the application with os.Exit and
-// the return code -1.
+// the fatal exit code, by default -1.
 func OsFatalExiter() {
-	os.Exit(-1)
+	os.Exit(FatalExitCode())
 }
 
 // PanacFatalExiter exits the application with a panic.
@@ -62,9 +105,10 @@ func PanicFatalExiter() {
 
 // Log control variables.
 var (
-	logMux         sync.Mutex
-	logLevel       LogLevel        = LevelInfo
-	logFatalExiter FatalExiterFunc = OsFatalExiter
+	logMux           sync.Mutex
+	logLevel         LogLevel        = LevelInfo
+	logPackageLevels                 = make(map[string]LogLevel)
+	logFatalExiter   FatalExiterFunc = OsFatalExiter
 )
 
 // Level returns the current log level.
@@ -80,17 +124,51 @@ func SetLevel(level LogLevel) LogLevel {
 	logMux.Lock()
 	defer logMux.Unlock()
 	current := logLevel
-	switch {
-	case level <= LevelDebug:
-		logLevel = LevelDebug
-	case level >= LevelFatal:
-		logLevel = LevelFatal
-	default:
-		logLevel = level
-	}
+	logLevel = validLevel(level)
+	return current
+}
+
+// PackageLevel returns the log level used for the given package.
+// It's the level set for the package or the nearest parent package,
+// otherwise the global log level.
+func PackageLevel(pkg string) LogLevel {
+	logMux.Lock()
+	defer logMux.Unlock()
+	return packageLevel(pkg)
+}
+
+// SetPackageLevel sets an individual log level for a package and its
+// sub-packages. It returns the level used for the package before.
+func SetPackageLevel(pkg string, level LogLevel) LogLevel {
+	logMux.Lock()
+	defer logMux.Unlock()
+	current := packageLevel(pkg)
+	logPackageLevels[pkg] = validLevel(level)
+	return current
+}
+
+// UnsetPackageLevel removes the individual log level of a package
+// and returns the level used for the package before.
+func UnsetPackageLevel(pkg string) LogLevel {
+	logMux.Lock()
+	defer logMux.Unlock()
+	current := packageLevel(pkg)
+	delete(logPackageLevels, pkg)
 	return current
 }
 
+// PackageLevels returns a copy of all individually set package
+// log levels.
+func PackageLevels() map[string]LogLevel {
+	logMux.Lock()
+	defer logMux.Unlock()
+	pls := make(map[string]LogLevel, len(logPackageLevels))
+	for pkg, level := range logPackageLevels {
+		pls[pkg] = level
+	}
+	return pls
+}
+
 // SetFatalExiter sets the fatal exiter function and
 // returns the current one.
 func SetFatalExiter(fef FatalExiterFunc) FatalExiterFunc {
@@ -107,76 +185,218 @@ func SetFatalExiter(fef FatalExiterFunc) FatalExiterFunc {
 
 // Debugf logs a message at debug level.
 func Debugf(format string, args ...interface{}) {
-	logMux.Lock()
-	defer logMux.Unlock()
-	if logLevel <= LevelDebug {
-		ci := retrieveCallInfo()
-		fi := fmt.Sprintf(format, args...)
-
-		logBackend.Debug(ci.verboseFormat(), fi)
-	}
+	logf(1, LevelDebug, format, args...)
 }
 
 // Infof logs a message at info level.
 func Infof(format string, args ...interface{}) {
-	logMux.Lock()
-	defer logMux.Unlock()
-	if logLevel <= LevelInfo {
-		ci := retrieveCallInfo()
-		fi := fmt.Sprintf(format, args...)
-
-		logBackend.Info(ci.shortFormat(), fi)
-	}
+	logf(1, LevelInfo, format, args...)
 }
 
 // Warningf logs a message at warning level.
 func Warningf(format string, args ...interface{}) {
-	logMux.Lock()
-	defer logMux.Unlock()
-	if logLevel <= LevelWarning {
-		ci := retrieveCallInfo()
-		fi := fmt.Sprintf(format, args...)
-
-		logBackend.Warning(ci.shortFormat(), fi)
-	}
+	logf(1, LevelWarning, format, args...)
 }
 
 // Errorf logs a message at error level.
 func Errorf(format string, args ...interface{}) {
-	logMux.Lock()
-	defer logMux.Unlock()
-	if logLevel <= LevelError {
-		ci := retrieveCallInfo()
-		fi := fmt.Sprintf(format, args...)
-
-		logBackend.Error(ci.shortFormat(), fi)
-	}
+	logf(1, LevelError, format, args...)
 }
 
 // Criticalf logs a message at critical level.
 func Criticalf(format string, args ...interface{}) {
-	logMux.Lock()
-	defer logMux.Unlock()
-	if logLevel <= LevelCritical {
-		ci := retrieveCallInfo()
-		fi := fmt.Sprintf(format, args...)
-
-		logBackend.Critical(ci.verboseFormat(), fi)
-	}
+	logf(1, LevelCritical, format, args...)
 }
 
 // Fatalf logs a message independant of any level. After
-// logging the message the functions calls the fatal exiter
-// function, which by default means exiting the application
-// with error code -1.
+// logging the message the function runs the shutdown sequence
+// and calls the fatal exiter function, which by default means
+// exiting the application with the fatal exit code.
 func Fatalf(format string, args ...interface{}) {
+	logf(1, LevelFatal, format, args...)
+}
+
+// Logf logs a message at the passed level. The fatal level
+// behaves like Fatalf.
+func Logf(level LogLevel, format string, args ...interface{}) {
+	logf(1, validLevel(level), format, args...)
+}
+
+// LogDepthf logs a message at the passed level like Logf. The
+// call info is the one of the function depth levels above the
+// caller of LogDepthf, 0 is the caller itself. This way functions
+// wrapping the logging can report the call info of their callers.
+func LogDepthf(depth int, level LogLevel, format string, args ...interface{}) {
+	logf(depth+1, validLevel(level), format, args...)
+}
+
+// LogContextf logs a message at the passed level like Logf. The
+// context is passed with the record to backends implementing the
+// RecordLogger, e.g. to bind log statements to a test.
+func LogContextf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	logContextf(ctx, 1, validLevel(level), format, args...)
+}
+
+// Helper marks the calling function as logging helper. Like with
+// testing.T.Helper() log statements inside of helpers, or of functions
+// called by them, get the call info of the first caller not being a
+// helper.
+func Helper() {
+	pcs := make([]uintptr, 1)
+	runtime.Callers(2, pcs)
+	frame, _ := runtime.CallersFrames(pcs).Next()
+	if _, loaded := helpers.LoadOrStore(frame.Function, true); !loaded {
+		atomic.AddInt64(&helpersGeneration, 1)
+	}
+}
+
+// logf checks the level and logs the message on the backend. The
+// call info is the one of the function skip levels above the caller
+// of logf. Only its program counter is retrieved, the info itself
+// is resolved when needed.
+func logf(skip int, level LogLevel, format string, args ...interface{}) {
+	logContextf(nil, skip+1, level, format, args...)
+}
+
+// logContextf works like logf but passes the context with the record.
+func logContextf(ctx context.Context, skip int, level LogLevel, format string, args ...interface{}) {
 	logMux.Lock()
-	defer logMux.Unlock()
-	ci := retrieveCallInfo()
-	fi := fmt.Sprintf(format, args...)
+	disabled := len(logPackageLevels) == 0 && level < logLevel
+	logMux.Unlock()
+	if disabled {
+		return
+	}
+	r := &Record{
+		Time:  time.Now(),
+		Level: level,
+		ctx:   ctx,
+	}
+	r.pc = caller(skip + 1)
+	r.Message = fmt.Sprintf(format, args...)
+
+	logEntry(r)
+}
+
+// logEntry logs the record if the level is enabled for its package.
+// In case of the fatal level the shutdown sequence is started.
+func logEntry(r *Record) {
+	logMux.Lock()
+	enabled := r.Level >= logLevel
+	if len(logPackageLevels) > 0 {
+		enabled = r.Level >= packageLevel(r.Package())
+	}
+	if !enabled {
+		logMux.Unlock()
+		return
+	}
+	logRecord(logBackend, r)
+	backend := logBackend
+	fef := logFatalExiter
+	logMux.Unlock()
+
+	if r.Level == LevelFatal {
+		shutdown(backend, fef)
+	}
+}
+
+// logRecord passes the record to the backend. Backends implementing
+// RecordLogger get the whole record, all others the formatted info
+// and the message.
+func logRecord(backend Logger, r *Record) {
+	if rl, ok := backend.(RecordLogger); ok {
+		rl.LogRecord(r)
+		return
+	}
+	switch r.Level {
+	case LevelDebug:
+		backend.Debug(r.Info(), r.Message)
+	case LevelInfo:
+		backend.Info(r.Info(), r.Message)
+	case LevelWarning:
+		backend.Warning(r.Info(), r.Message)
+	case LevelError:
+		backend.Error(r.Info(), r.Message)
+	case LevelCritical:
+		backend.Critical(r.Info(), r.Message)
+	default:
+		backend.Fatal(r.Info(), r.Message)
+	}
+}
+
+//--------------------
+// RECORD
+//--------------------
+
+// Record contains the data of one log statement. The call
+// info is resolved when accessed the first time.
+type Record struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+	pc      uintptr
+	info    *callInfo
+	ctx     context.Context
+}
+
+// newRecord creates a record for the current time.
+func newRecord(level LogLevel, ci *callInfo, msg string) *Record {
+	return &Record{
+		Time:    time.Now(),
+		Level:   level,
+		Message: msg,
+		info:    ci,
+	}
+}
+
+// Package returns the name of the package containing
+// the log statement.
+func (r *Record) Package() string {
+	return r.callInfo().packageName
+}
+
+// File returns the name of the file containing the log statement.
+func (r *Record) File() string {
+	return r.callInfo().fileName
+}
+
+// Func returns the name of the function containing
+// the log statement.
+func (r *Record) Func() string {
+	return r.callInfo().funcName
+}
+
+// Line returns the line number of the log statement.
+func (r *Record) Line() int {
+	return r.callInfo().line
+}
+
+// Info returns the call info in the format a Logger gets
+// it. Debug, critical, and fatal messages get a verbose
+// info, all other a short one.
+func (r *Record) Info() string {
+	switch r.Level {
+	case LevelDebug, LevelCritical, LevelFatal:
+		return r.callInfo().verboseFormat()
+	default:
+		return r.callInfo().shortFormat()
+	}
+}
 
-	logBackend.Fatal(ci.verboseFormat(), fi)
-	logFatalExiter()
+// Context returns the context the record has been logged with. It
+// is the background context if none has been passed.
+func (r *Record) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// callInfo returns the call info of the record.
+func (r *Record) callInfo() *callInfo {
+	if r.info != nil {
+		return r.info
+	}
+	return lookupCallInfo(r.pc)
 }
 
 //--------------------
@@ -204,105 +424,126 @@ type Logger interface {
 	Fatal(info, msg string)
 }
 
+// RecordLogger is an optional extension of a Logger. Backends
+// implementing it get the whole record of a log statement instead
+// of the preformatted info.
+type RecordLogger interface {
+	Logger
+
+	// LogRecord logs the passed record.
+	LogRecord(r *Record)
+}
+
 // logger references the used application logger.
 var logBackend Logger = NewStandardLogger(os.Stdout)
 
 // SetLogger sets a new logger.
 func SetLogger(l Logger) {
+	logMux.Lock()
+	defer logMux.Unlock()
+	logBackend = l
+}
+
+// SwapLogger sets a new logger and returns the replaced one.
+func SwapLogger(l Logger) Logger {
+	logMux.Lock()
+	defer logMux.Unlock()
+	current := logBackend
 	logBackend = l
+	return current
 }
 
-// timeFormat controls how the timestamp of the standard logger is printed.
-const timeFormat = "2006-01-02 15:04:05 Z07:00"
+// Backends returns the active logger backends. In case of a
+// MultiLogger these are its individual backends.
+func Backends() []Logger {
+	logMux.Lock()
+	defer logMux.Unlock()
+	if ml, ok := logBackend.(*MultiLogger); ok {
+		return ml.Backends()
+	}
+	return []Logger{logBackend}
+}
 
 // StandardLogger is a simple logger writing to the given writer. Beside
-// the output it doesn't handle the levels differently.
+// the output it doesn't handle the levels differently. The layout of
+// the lines is defined by a Formatter.
 type StandardLogger struct {
-	mutex sync.Mutex
-	out   io.Writer
+	mutex     sync.Mutex
+	out       io.Writer
+	formatter Formatter
 }
 
-// NewStandardLogger creates the standard logger.
+// NewStandardLogger creates the standard logger writing the
+// lines in the format "time [LEVEL] info message".
 func NewStandardLogger(out io.Writer) Logger {
-	return &StandardLogger{out: out}
+	return NewFormattedLogger(out, NewTextFormatter("", false))
+}
+
+// NewFormattedLogger creates a standard logger writing the lines
+// in the layout of the passed formatter.
+func NewFormattedLogger(out io.Writer, f Formatter) Logger {
+	return &StandardLogger{
+		out:       out,
+		formatter: f,
+	}
 }
 
 // Debug is specified on the Logger interface.
 func (sl *StandardLogger) Debug(info, msg string) {
-	sl.mutex.Lock()
-	defer sl.mutex.Unlock()
-
-	io.WriteString(sl.out, time.Now().Format(timeFormat))
-	io.WriteString(sl.out, " [DEBUG] ")
-	io.WriteString(sl.out, info)
-	io.WriteString(sl.out, " ")
-	io.WriteString(sl.out, msg)
-	io.WriteString(sl.out, "\n")
+	sl.LogRecord(newRecord(LevelDebug, parseCallInfo(info), msg))
 }
 
 // Info is specified on the Logger interface.
 func (sl *StandardLogger) Info(info, msg string) {
-	sl.mutex.Lock()
-	defer sl.mutex.Unlock()
-
-	io.WriteString(sl.out, time.Now().Format(timeFormat))
-	io.WriteString(sl.out, " [INFO] ")
-	io.WriteString(sl.out, info)
-	io.WriteString(sl.out, " ")
-	io.WriteString(sl.out, msg)
-	io.WriteString(sl.out, "\n")
+	sl.LogRecord(newRecord(LevelInfo, parseCallInfo(info), msg))
 }
 
 // Warning is specified on the Logger interface.
 func (sl *StandardLogger) Warning(info, msg string) {
-	sl.mutex.Lock()
-	defer sl.mutex.Unlock()
-
-	io.WriteString(sl.out, time.Now().Format(timeFormat))
-	io.WriteString(sl.out, " [WARNING] ")
-	io.WriteString(sl.out, info)
-	io.WriteString(sl.out, " ")
-	io.WriteString(sl.out, msg)
-	io.WriteString(sl.out, "\n")
+	sl.LogRecord(newRecord(LevelWarning, parseCallInfo(info), msg))
 }
 
 // Error is specified on the Logger interface.
 func (sl *StandardLogger) Error(info, msg string) {
-	sl.mutex.Lock()
-	defer sl.mutex.Unlock()
-
-	io.WriteString(sl.out, time.Now().Format(timeFormat))
-	io.WriteString(sl.out, " [ERROR] ")
-	io.WriteString(sl.out, info)
-	io.WriteString(sl.out, " ")
-	io.WriteString(sl.out, msg)
-	io.WriteString(sl.out, "\n")
+	sl.LogRecord(newRecord(LevelError, parseCallInfo(info), msg))
 }
 
 // Critical is specified on the Logger interface.
 func (sl *StandardLogger) Critical(info, msg string) {
+	sl.LogRecord(newRecord(LevelCritical, parseCallInfo(info), msg))
+}
+
+// Fatal is specified on the Logger interface.
+func (sl *StandardLogger) Fatal(info, msg string) {
+	sl.LogRecord(newRecord(LevelFatal, parseCallInfo(info), msg))
+}
+
+// LogRecord is specified on the RecordLogger interface.
+func (sl *StandardLogger) LogRecord(r *Record) {
+	line := sl.formatter.Format(r)
+
 	sl.mutex.Lock()
 	defer sl.mutex.Unlock()
 
-	io.WriteString(sl.out, time.Now().Format(timeFormat))
-	io.WriteString(sl.out, " [CRITICAL] ")
-	io.WriteString(sl.out, info)
-	io.WriteString(sl.out, " ")
-	io.WriteString(sl.out, msg)
+	io.WriteString(sl.out, line)
 	io.WriteString(sl.out, "\n")
 }
 
-// Fatal is specified on the Logger interface.
-func (sl *StandardLogger) Fatal(info, msg string) {
+// Flush is specified on the Flusher interface. It flushes or syncs
+// the writer if it supports it.
+func (sl *StandardLogger) Flush() error {
 	sl.mutex.Lock()
 	defer sl.mutex.Unlock()
 
-	io.WriteString(sl.out, time.Now().Format(timeFormat))
-	io.WriteString(sl.out, " [FATAL] ")
-	io.WriteString(sl.out, info)
-	io.WriteString(sl.out, " ")
-	io.WriteString(sl.out, msg)
-	io.WriteString(sl.out, "\n")
+	switch out := sl.out.(type) {
+	case Flusher:
+		return out.Flush()
+	case interface {
+		Sync() error
+	}:
+		return out.Sync()
+	}
+	return nil
 }
 
 // GoLogger just uses the standard go log package.
@@ -344,10 +585,118 @@ func (gl *GoLogger) Fatal(info, msg string) {
 	log.Println("[FATAL]", info, msg)
 }
 
+// MultiLogger passes all log statements to multiple backends.
+type MultiLogger struct {
+	backends []Logger
+}
+
+// NewMultiLogger returns a logger passing all log statements
+// to the given backends.
+func NewMultiLogger(backends ...Logger) *MultiLogger {
+	return &MultiLogger{backends}
+}
+
+// Backends returns the backends of the multi logger.
+func (ml *MultiLogger) Backends() []Logger {
+	return append([]Logger{}, ml.backends...)
+}
+
+// Debug is specified on the Logger interface.
+func (ml *MultiLogger) Debug(info, msg string) {
+	for _, backend := range ml.backends {
+		backend.Debug(info, msg)
+	}
+}
+
+// Info is specified on the Logger interface.
+func (ml *MultiLogger) Info(info, msg string) {
+	for _, backend := range ml.backends {
+		backend.Info(info, msg)
+	}
+}
+
+// Warning is specified on the Logger interface.
+func (ml *MultiLogger) Warning(info, msg string) {
+	for _, backend := range ml.backends {
+		backend.Warning(info, msg)
+	}
+}
+
+// Error is specified on the Logger interface.
+func (ml *MultiLogger) Error(info, msg string) {
+	for _, backend := range ml.backends {
+		backend.Error(info, msg)
+	}
+}
+
+// Critical is specified on the Logger interface.
+func (ml *MultiLogger) Critical(info, msg string) {
+	for _, backend := range ml.backends {
+		backend.Critical(info, msg)
+	}
+}
+
+// Fatal is specified on the Logger interface.
+func (ml *MultiLogger) Fatal(info, msg string) {
+	for _, backend := range ml.backends {
+		backend.Fatal(info, msg)
+	}
+}
+
+// LogRecord is specified on the RecordLogger interface.
+func (ml *MultiLogger) LogRecord(r *Record) {
+	for _, backend := range ml.backends {
+		logRecord(backend, r)
+	}
+}
+
+// Flush is specified on the Flusher interface. It flushes all
+// backends and returns the first error.
+func (ml *MultiLogger) Flush() error {
+	var ferr error
+	for _, backend := range ml.backends {
+		if f, ok := backend.(Flusher); ok {
+			if err := f.Flush(); err != nil && ferr == nil {
+				ferr = err
+			}
+		}
+	}
+	return ferr
+}
+
 //--------------------
 // HELPER
 //--------------------
 
+// validLevel returns the level limited to the valid range.
+func validLevel(level LogLevel) LogLevel {
+	switch {
+	case level <= LevelDebug:
+		return LevelDebug
+	case level >= LevelFatal:
+		return LevelFatal
+	default:
+		return level
+	}
+}
+
+// packageLevel returns the level for a package. The caller
+// has to hold the log mutex.
+func packageLevel(pkg string) LogLevel {
+	level := logLevel
+	match := ""
+	for lpkg, llevel := range logPackageLevels {
+		if pkg != lpkg && !strings.HasPrefix(pkg, lpkg+"/") {
+			continue
+		}
+		if len(lpkg) > len(match) {
+			level = llevel
+			match = lpkg
+		}
+	}
+	return level
+}
+
 // callInfo bundles the info about the call environment
 // when a logging statement occured.
 type callInfo struct {
@@ -355,40 +704,175 @@ type callInfo struct {
 	fileName    string
 	funcName    string
 	line        int
+	raw         string
 }
 
 // shortFormat returns a string representation in a short variant.
 func (ci *callInfo) shortFormat() string {
+	if ci.raw != "" {
+		return ci.raw
+	}
 	return fmt.Sprintf("[%s]", ci.packageName)
 }
 
 // verboseFormat returns a string representation in a more verbose variant.
 func (ci *callInfo) verboseFormat() string {
+	if ci.raw != "" {
+		return ci.raw
+	}
 	return fmt.Sprintf("[%s] (%s:%s:%d)", ci.packageName, ci.fileName, ci.funcName, ci.line)
 }
 
-// retrieveCallInfo
-func retrieveCallInfo() *callInfo {
-	pc, file, line, _ := runtime.Caller(2)
-	_, fileName := path.Split(file)
-	parts := strings.Split(runtime.FuncForPC(pc).Name(), ".")
-	pl := len(parts)
-	packageName := ""
-	funcName := parts[pl-1]
+// Call info variables. The cached infos and helper checks per
+// program counter are only valid for the generation of the marked
+// helpers they have been created for.
+var (
+	callInfos         sync.Map
+	helperPCs         sync.Map
+	helpers           sync.Map
+	helpersGeneration int64
+)
+
+// cachedCallInfo is the call info of a program counter.
+type cachedCallInfo struct {
+	generation int64
+	info       *callInfo
+}
+
+// cachedHelperPC tells if a program counter is inside of a helper.
+type cachedHelperPC struct {
+	generation int64
+	helper     bool
+}
+
+// caller returns the program counter of the function skip levels
+// above the caller of caller. If helpers are marked the program
+// counter of the first caller not being a helper is returned instead.
+// Only the program counters are checked, the call info is resolved
+// when needed.
+func caller(skip int) uintptr {
+	pcs := make([]uintptr, 1)
+	runtime.Callers(skip+2, pcs)
+	if atomic.LoadInt64(&helpersGeneration) == 0 || !isHelperPC(pcs[0]) {
+		return pcs[0]
+	}
+	pcs = make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	for _, pc := range pcs[:n] {
+		if !isHelperPC(pc) {
+			return pc
+		}
+	}
+	return pcs[n-1]
+}
+
+// isHelperPC checks if all functions at the program counter, also
+// the inlined ones, are marked as helpers. The result is resolved
+// only once per program counter and generation of helpers.
+func isHelperPC(pc uintptr) bool {
+	generation := atomic.LoadInt64(&helpersGeneration)
+	if chpc, ok := helperPCs.Load(pc); ok && chpc.(*cachedHelperPC).generation == generation {
+		return chpc.(*cachedHelperPC).helper
+	}
+	helper := true
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		if !isHelper(frame.Function) {
+			helper = false
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	helperPCs.Store(pc, &cachedHelperPC{generation, helper})
+	return helper
+}
+
+// isHelper checks if the function is marked as helper.
+func isHelper(function string) bool {
+	_, ok := helpers.Load(function)
+	return ok
+}
 
-	if parts[pl-2][0] == '(' {
-		funcName = parts[pl-2] + "." + funcName
-		packageName = strings.Join(parts[0:pl-2], ".")
-	} else {
-		packageName = strings.Join(parts[0:pl-1], ".")
+// lookupCallInfo returns the call info for a program counter. It
+// is resolved only once per program counter and generation of helpers.
+func lookupCallInfo(pc uintptr) *callInfo {
+	generation := atomic.LoadInt64(&helpersGeneration)
+	if cci, ok := callInfos.Load(pc); ok && cci.(*cachedCallInfo).generation == generation {
+		return cci.(*cachedCallInfo).info
 	}
+	ci := callInfoForPC(pc)
+	callInfos.Store(pc, &cachedCallInfo{generation, ci})
+	return ci
+}
+
+// callInfoForPC returns the call info for a program counter
+// as returned by runtime.Callers(). In case of inlined functions
+// the first one not being a helper is used.
+func callInfoForPC(pc uintptr) *callInfo {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		if !more || !isHelper(frame.Function) {
+			return callInfoForFrame(frame)
+		}
+	}
+}
+
+// callInfoForFrame returns the call info for a stack frame.
+func callInfoForFrame(frame runtime.Frame) *callInfo {
+	_, fileName := path.Split(frame.File)
+	packageName, funcName := splitFuncName(frame.Function)
 
 	return &callInfo{
 		packageName: packageName,
 		fileName:    fileName,
 		funcName:    funcName,
-		line:        line,
+		line:        frame.Line,
+	}
+}
+
+// splitFuncName splits a full function name into the package
+// name and the function name.
+func splitFuncName(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	dot += slash + 1
+	return name[:dot], name[dot+1:]
+}
+
+// parseCallInfo creates a call info out of an info string as
+// passed to the Logger methods. Unknown parts stay empty, the
+// info itself is kept for the formatting.
+func parseCallInfo(info string) *callInfo {
+	ci := &callInfo{raw: info}
+	if !strings.HasPrefix(info, "[") {
+		ci.packageName = info
+		return ci
+	}
+	end := strings.Index(info, "]")
+	if end < 0 {
+		ci.packageName = info
+		return ci
+	}
+	ci.packageName = info[1:end]
+	rest := strings.TrimSpace(info[end+1:])
+	if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+		return ci
+	}
+	parts := strings.Split(rest[1:len(rest)-1], ":")
+	if len(parts) != 3 {
+		return ci
 	}
+	ci.fileName = parts[0]
+	ci.funcName = parts[1]
+	ci.line, _ = strconv.Atoi(parts[2])
+	return ci
 }
 
 // EOF
@@ -12,9 +12,19 @@ package logger_test
 //--------------------
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tideland/goas/v3/logger"
 	"github.com/tideland/gots/v3/asserts"
@@ -109,6 +119,22 @@ func TestOwnLogger(t *testing.T) {
 	assert.Length(ownLogger.logs, 5)
 }
 
+// Test swapping the logger.
+func TestSwapLogger(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	firstLogger := &testLogger{}
+	secondLogger := &testLogger{}
+
+	logger.SetLevel(logger.LevelDebug)
+	logger.SetLogger(firstLogger)
+	replaced := logger.SwapLogger(secondLogger)
+	logger.Infof("Info.")
+
+	assert.Equal(replaced, logger.Logger(firstLogger))
+	assert.Length(firstLogger.logs, 0)
+	assert.Length(secondLogger.logs, 1)
+}
+
 // TestFatalExit tests the call of the fatal exiter after a
 // fatal error log.
 func TestFatalExit(t *testing.T) {
@@ -127,10 +153,465 @@ func TestFatalExit(t *testing.T) {
 	assert.True(exited)
 }
 
+// TestFatalShutdown tests the shutdown sequence after a fatal
+// error log.
+func TestFatalShutdown(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	fl := &flushingLogger{logger.NewRingLogger(10), false}
+	calls := []string{}
+	exited := false
+	fatalExiter := func() {
+		calls = append(calls, "exit")
+		exited = true
+	}
+
+	logger.SetLevel(logger.LevelInfo)
+	logger.SetLogger(fl)
+	logger.SetFatalExiter(fatalExiter)
+	defer logger.ClearShutdownHooks()
+	logger.AddShutdownHook("first", func() error {
+		calls = append(calls, "first")
+		logger.Infof("first hook")
+		return nil
+	})
+	logger.AddShutdownHook("second", func() error {
+		calls = append(calls, "second")
+		return errors.New("ouch")
+	})
+	logger.AddShutdownHook("third", func() error {
+		calls = append(calls, "third")
+		panic("ouch")
+	})
+
+	logger.Fatalf("fatal")
+	assert.True(exited)
+	assert.True(fl.flushed)
+	assert.Equal(calls, []string{"first", "second", "third", "exit"})
+	rs := fl.Records()
+	assert.Length(rs, 4)
+	assert.Equal(rs[0].Level, logger.LevelFatal)
+	assert.Equal(rs[1].Message, "first hook")
+	assert.Equal(rs[2].Message, `shutdown hook "second" failed: ouch`)
+	assert.Equal(rs[3].Message, `shutdown hook "third" failed: panic: ouch`)
+
+	release := make(chan struct{})
+	defer close(release)
+	logger.ClearShutdownHooks()
+	logger.AddShutdownHook("blocking", func() error {
+		<-release
+		return nil
+	})
+	timeout := logger.SetShutdownTimeout(10 * time.Millisecond)
+	defer logger.SetShutdownTimeout(timeout)
+	exited = false
+	fl.Reset()
+
+	logger.Fatalf("fatal")
+	assert.True(exited)
+	rs = fl.Records(logger.LevelFilter(logger.LevelCritical))
+	assert.Length(rs, 2)
+	assert.Equal(rs[1].Message, "shutdown hooks timed out after 10ms")
+
+	code := logger.SetFatalExitCode(42)
+	assert.Equal(code, -1)
+	assert.Equal(logger.FatalExitCode(), 42)
+	logger.SetFatalExitCode(code)
+}
+
+// TestConcurrentFatal tests fatal error logs inside of a running
+// shutdown sequence and concurrent to it.
+func TestConcurrentFatal(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+	var exits int32
+	fatalExiter := func() {
+		atomic.AddInt32(&exits, 1)
+	}
+
+	logger.SetLogger(rl)
+	logger.SetFatalExiter(fatalExiter)
+	defer logger.ClearShutdownHooks()
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	logger.AddShutdownHook("reentrant", func() error {
+		entered <- struct{}{}
+		// Returns without starting the shutdown again.
+		logger.Fatalf("hook")
+		<-release
+		return nil
+	})
+
+	first := make(chan struct{})
+	go func() {
+		logger.Fatalf("first")
+		close(first)
+	}()
+	<-entered
+	// Returns without waiting for the running shutdown.
+	logger.Fatalf("second")
+	assert.Equal(atomic.LoadInt32(&exits), int32(0))
+
+	close(release)
+	<-first
+	assert.Equal(atomic.LoadInt32(&exits), int32(1))
+
+	// The ended shutdown can be started again.
+	logger.Fatalf("third")
+	assert.Equal(atomic.LoadInt32(&exits), int32(2))
+	rs := rl.Records()
+	assert.Length(rs, 5)
+	assert.Equal(rs[0].Message, "first")
+	assert.Equal(rs[1].Message, "hook")
+	assert.Equal(rs[2].Message, "second")
+	assert.Equal(rs[3].Message, "third")
+	assert.Equal(rs[4].Message, "hook")
+}
+
+// Test logging with an explicit depth and with helpers.
+func TestDepthAndHelpers(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+
+	logger.SetLevel(logger.LevelDebug)
+	logger.SetLogger(rl)
+
+	logger.Logf(logger.LevelWarning, "Warning %d.", 1)
+	depthWrapper("Depth.")
+	helperWrapper("Helper.")
+	nestedHelperWrapper("Nested.")
+
+	rs := rl.Records()
+	assert.Length(rs, 4)
+	assert.Equal(rs[0].Level, logger.LevelWarning)
+	for _, r := range rs {
+		assert.Equal(r.Package(), "github.com/tideland/goas/v3/logger_test")
+		assert.Equal(r.Func(), "TestDepthAndHelpers")
+	}
+	assert.True(rs[0].Line() < rs[1].Line())
+	assert.True(rs[1].Line() < rs[2].Line())
+	assert.True(rs[2].Line() < rs[3].Line())
+}
+
+// Test logging with the ring logger.
+func TestRingLogger(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(5)
+
+	logger.SetLevel(logger.LevelDebug)
+	logger.SetLogger(rl)
+
+	logger.Debugf("Debug.")
+	logger.Infof("Info.")
+	logger.Warningf("Warning.")
+	logger.Errorf("Error.")
+	logger.Criticalf("Critical.")
+
+	rs := rl.Records()
+	assert.Length(rs, 5)
+	assert.Equal(rs[0].Level, logger.LevelDebug)
+	assert.Equal(rs[0].Message, "Debug.")
+	assert.Equal(rs[0].Package(), "github.com/tideland/goas/v3/logger_test")
+	assert.Equal(rs[0].File(), "logger_test.go")
+	assert.Equal(rs[0].Func(), "TestRingLogger")
+	assert.Equal(rs[4].Level, logger.LevelCritical)
+
+	logger.Infof("Info %d.", 2)
+
+	rs = rl.Snapshot()
+	assert.Length(rs, 5)
+	assert.Equal(rs[0].Message, "Info.")
+	assert.Equal(rs[4].Message, "Info 2.")
+
+	rs = rl.Records(logger.LevelFilter(logger.LevelError))
+	assert.Length(rs, 2)
+	rs = rl.Records(logger.LevelFilter(logger.LevelInfo), logger.PackageFilter("github.com/tideland/goas/v3/logger_test"))
+	assert.Length(rs, 5)
+	rs = rl.Records(logger.PackageFilter("github.com/tideland/goas/v3/logger"))
+	assert.Length(rs, 0)
+	rs = rl.Records(logger.TimeFilter(time.Now().Add(time.Second), time.Time{}))
+	assert.Length(rs, 0)
+	rs = rl.Records(logger.TimeFilter(time.Time{}, time.Now()))
+	assert.Length(rs, 5)
+
+	rl.Reset()
+	assert.Equal(rl.Len(), 0)
+}
+
+// Test subscribing to the ring logger.
+func TestRingLoggerSubscribe(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+	rc := make(chan *logger.Record, 10)
+
+	logger.SetLevel(logger.LevelDebug)
+	logger.SetLogger(rl)
+	rl.Subscribe(rc, logger.LevelFilter(logger.LevelWarning))
+
+	logger.Debugf("Debug.")
+	logger.Warningf("Warning.")
+	logger.Errorf("Error.")
+	rl.Unsubscribe(rc)
+	logger.Criticalf("Critical.")
+
+	assert.Length(rc, 2)
+	r := <-rc
+	assert.Equal(r.Message, "Warning.")
+	r = <-rc
+	assert.Equal(r.Message, "Error.")
+	assert.Equal(rl.Len(), 4)
+}
+
+// Test individual package levels.
+func TestPackageLevels(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+	pkg := "github.com/tideland/goas/v3/logger_test"
+
+	logger.SetLevel(logger.LevelError)
+	logger.SetLogger(rl)
+
+	logger.Infof("Info.")
+	assert.Equal(rl.Len(), 0)
+
+	logger.SetPackageLevel("github.com/tideland/goas", logger.LevelDebug)
+	assert.Equal(logger.PackageLevel(pkg), logger.LevelDebug)
+	logger.SetPackageLevel(pkg, logger.LevelWarning)
+	assert.Equal(logger.PackageLevel(pkg), logger.LevelWarning)
+	assert.Length(logger.PackageLevels(), 2)
+
+	logger.Infof("Info.")
+	logger.Warningf("Warning.")
+	assert.Equal(rl.Len(), 1)
+
+	logger.UnsetPackageLevel(pkg)
+	logger.UnsetPackageLevel("github.com/tideland/goas")
+	assert.Equal(logger.PackageLevel(pkg), logger.LevelError)
+	assert.Length(logger.PackageLevels(), 0)
+
+	level, err := logger.ParseLevel("critical")
+	assert.Nil(err)
+	assert.Equal(level, logger.LevelCritical)
+	_, err = logger.ParseLevel("yadda")
+	assert.True(logger.IsInvalidLevelError(err))
+}
+
+// Test the control handler.
+func TestControlHandler(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+	srv := httptest.NewServer(logger.NewControlHandler(rl))
+	defer srv.Close()
+
+	logger.SetLevel(logger.LevelInfo)
+	logger.SetLogger(logger.NewMultiLogger(rl, &testLogger{}))
+
+	status := struct {
+		Level    string
+		Packages map[string]string
+		Backends []string
+	}{}
+	resp, err := http.PostForm(srv.URL, url.Values{"level": {"debug"}})
+	assert.Nil(err)
+	assert.Equal(resp.StatusCode, http.StatusOK)
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	assert.Nil(err)
+	assert.Equal(status.Level, "DEBUG")
+	assert.Equal(status.Backends, []string{"*logger.RingLogger", "*logger_test.testLogger"})
+	assert.Equal(logger.Level(), logger.LevelDebug)
+
+	resp, err = http.PostForm(srv.URL, url.Values{"level": {"error"}, "package": {"foo/bar"}})
+	assert.Nil(err)
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	assert.Nil(err)
+	assert.Equal(status.Packages, map[string]string{"foo/bar": "ERROR"})
+
+	req, err := http.NewRequest("DELETE", srv.URL+"?package=foo/bar", nil)
+	assert.Nil(err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(err)
+	resp.Body.Close()
+	assert.Length(logger.PackageLevels(), 0)
+
+	resp, err = http.PostForm(srv.URL, url.Values{"level": {"yadda"}})
+	assert.Nil(err)
+	resp.Body.Close()
+	assert.Equal(resp.StatusCode, http.StatusBadRequest)
+
+	logger.Debugf("Debug.")
+	logger.Infof("Info.")
+	logger.Errorf("Error.")
+
+	records := []struct {
+		Level   string
+		Package string
+		Message string
+	}{}
+	resp, err = http.Get(srv.URL + "/records?level=info&limit=1")
+	assert.Nil(err)
+	err = json.NewDecoder(resp.Body).Decode(&records)
+	resp.Body.Close()
+	assert.Nil(err)
+	assert.Length(records, 1)
+	assert.Equal(records[0].Level, "ERROR")
+	assert.Equal(records[0].Package, "github.com/tideland/goas/v3/logger_test")
+	assert.Equal(records[0].Message, "Error.")
+
+	resp, err = http.Get(srv.URL + "/records?from=yesterday")
+	assert.Nil(err)
+	resp.Body.Close()
+	assert.Equal(resp.StatusCode, http.StatusBadRequest)
+}
+
+// Test the standard logger with different formatters.
+func TestFormatters(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	buf := &bytes.Buffer{}
+
+	logger.SetLevel(logger.LevelDebug)
+
+	logger.SetLogger(logger.NewStandardLogger(buf))
+	logger.Infof("Info.")
+	logger.Debugf("Debug.")
+	assert.Match(buf.String(), `^.* \[INFO\] \[github.com/tideland/goas/v3/logger_test\] Info.\n`+
+		`.* \[DEBUG\] \[github.com/tideland/goas/v3/logger_test\] \(logger_test.go:TestFormatters:[0-9]+\) Debug.\n$`)
+
+	buf.Reset()
+	logger.SetLogger(logger.NewFormattedLogger(buf, logger.NewLogfmtFormatter(true)))
+	logger.Warningf("Warning %d.", 1)
+	logger.Criticalf("Critical.")
+	assert.Match(buf.String(), `^time=.*Z level=warning package=github.com/tideland/goas/v3/logger_test file=logger_test.go func=TestFormatters line=[0-9]+ msg="Warning 1."\n`+
+		`time=.*Z level=critical package=github.com/tideland/goas/v3/logger_test file=logger_test.go func=TestFormatters line=[0-9]+ msg=Critical.\n$`)
+
+	buf.Reset()
+	tf, err := logger.NewTemplateFormatter("{{.Level}}|{{.Package}}|{{.Func}}|{{.Message}}", "", false)
+	assert.Nil(err)
+	logger.SetLogger(logger.NewFormattedLogger(buf, logger.NewColorFormatter(tf, buf)))
+	logger.Errorf("Error.")
+	assert.Equal(buf.String(), "ERROR|github.com/tideland/goas/v3/logger_test|TestFormatters|Error.\n")
+
+	_, err = logger.NewTemplateFormatter("{{.Level", "", false)
+	assert.NotNil(err)
+}
+
+// Test the bridge from the log package.
+func TestLogBridge(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+
+	logger.SetLevel(logger.LevelInfo)
+	logger.SetLogger(rl)
+
+	l := log.New(logger.NewWriter(logger.LevelWarning), "", 0)
+	l.Printf("Warning %d.", 1)
+	l = log.New(logger.NewWriter(logger.LevelDebug), "", 0)
+	l.Printf("Debug.")
+
+	rs := rl.Records()
+	assert.Length(rs, 1)
+	assert.Equal(rs[0].Level, logger.LevelWarning)
+	assert.Equal(rs[0].Message, "Warning 1.")
+	assert.Equal(rs[0].Package(), "github.com/tideland/goas/v3/logger_test")
+	assert.Equal(rs[0].Func(), "TestLogBridge")
+}
+
+// Test the bridges from and to the slog package.
+func TestSlogBridges(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+
+	logger.SetLevel(logger.LevelInfo)
+	logger.SetLogger(rl)
+
+	sl := slog.New(logger.NewSlogHandler())
+	sl.Debug("Debug.")
+	sl.Info("Info.", "a", 1, "b", "x y")
+	sl.With("c", true).WithGroup("g").Error("Error.", slog.Group("h", "d", 2))
+
+	rs := rl.Records()
+	assert.Length(rs, 2)
+	assert.Equal(rs[0].Level, logger.LevelInfo)
+	assert.Equal(rs[0].Message, `Info. a=1 b="x y"`)
+	assert.Equal(rs[0].Package(), "github.com/tideland/goas/v3/logger_test")
+	assert.Equal(rs[0].Func(), "TestSlogBridges")
+	assert.Equal(rs[1].Level, logger.LevelError)
+	assert.Equal(rs[1].Message, "Error. c=true g.h.d=2")
+
+	buf := &bytes.Buffer{}
+	logger.SetLogger(logger.NewSlogLogger(slog.NewTextHandler(buf, nil)))
+	logger.Debugf("Debug.")
+	logger.Warningf("Warning.")
+	assert.Match(buf.String(), `^time=.* level=WARN msg=Warning. package=github.com/tideland/goas/v3/logger_test file=logger_test.go func=TestSlogBridges line=[0-9]+\n$`)
+}
+
+//--------------------
+// BENCHMARKS
+//--------------------
+
+// BenchmarkCallSites measures logging at a plain call site before
+// and after marking a helper as well as logging through helpers. The
+// plain call site has to stay as fast after marking the helper.
+func BenchmarkCallSites(b *testing.B) {
+	logger.SetLevel(logger.LevelInfo)
+	logger.SetLogger(logger.NewStandardLogger(io.Discard))
+	defer logger.SetLogger(logger.NewStandardLogger(os.Stdout))
+
+	b.Run("plain", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			logger.Infof("plain")
+		}
+	})
+	helperWrapper("mark")
+	b.Run("plain-with-helpers", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			logger.Infof("plain")
+		}
+	})
+	b.Run("helper", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			helperWrapper("helper")
+		}
+	})
+	b.Run("nested-helper", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			nestedHelperWrapper("nested")
+		}
+	})
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+func depthWrapper(msg string) {
+	logger.LogDepthf(1, logger.LevelInfo, "%s", msg)
+}
+
+func helperWrapper(msg string) {
+	logger.Helper()
+	logger.Infof("%s", msg)
+}
+
+func nestedHelperWrapper(msg string) {
+	logger.Helper()
+	helperWrapper(msg)
+}
+
 //--------------------
 // LOGGER
 //--------------------
 
+type flushingLogger struct {
+	*logger.RingLogger
+	flushed bool
+}
+
+func (fl *flushingLogger) Flush() error {
+	fl.flushed = true
+	return nil
+}
+
 type testLogger struct {
 	logs []string
 }
@@ -0,0 +1,45 @@
+// Tideland Go Application Support - Logger - Testing
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+// The loggertest package helps testing code which logs. A Recorder
+// started for a test records the log statements and provides
+// assertions on them.
+//
+//    func TestFoo(t *testing.T) {
+//        rec := loggertest.Start(t)
+//        err := foo.Do()
+//        ...
+//        rec.ExpectMessage(logger.LevelWarning, "retrying .* times")
+//        rec.ExpectNoErrors()
+//    }
+//
+// The recorder is stopped when the test ends. In case the test failed
+// the recorded statements are dumped to the test log. Parallel tests
+// can use own recorders without replacing the backend of each other.
+// Statements logged with the context of a recorder, e.g. passed to
+// logger.LogContextf(), are only recorded by this one, all others by
+// all recorders attached at that time.
+package loggertest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"github.com/tideland/goas/v1/version"
+)
+
+//--------------------
+// VERSION
+//--------------------
+
+// PackageVersion returns the version of the version package.
+func PackageVersion() version.Version {
+	return version.New(1, 0, 0)
+}
+
+// EOF
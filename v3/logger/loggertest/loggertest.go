@@ -0,0 +1,264 @@
+// Tideland Go Application Support - Logger - Testing
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loggertest
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/tideland/goas/v3/logger"
+)
+
+//--------------------
+// CONSTANTS
+//--------------------
+
+// recorderSize is the number of records a recorder retains.
+const recorderSize = 4096
+
+//--------------------
+// RECORDER
+//--------------------
+
+// recorderKey is the key of the recorder in its context.
+type recorderKey struct{}
+
+// Recorder records the log statements during a test.
+type Recorder struct {
+	tb         testing.TB
+	ctx        context.Context
+	ringLogger *logger.RingLogger
+	filters    []logger.RecordFilter
+}
+
+// Start creates a recorder for the test and attaches it to the
+// logger. Only the statements accepted by the passed filters are
+// recorded, e.g. those of the tested package. Statements logged
+// with the context of the recorder, e.g. with logger.LogContextf()
+// or slog functions like slog.InfoContext(), are only recorded by
+// this recorder. All other statements are recorded by all recorders
+// attached at that time, so parallel tests should log with their
+// contexts. The recorder is stopped when the test ends. In case of
+// a failed test the records are dumped to the test log.
+func Start(tb testing.TB, filters ...logger.RecordFilter) *Recorder {
+	r := &Recorder{
+		tb:         tb,
+		ringLogger: logger.NewRingLogger(recorderSize),
+		filters:    filters,
+	}
+	r.ctx = context.WithValue(context.Background(), recorderKey{}, r)
+	theDispatcher.attach(r)
+	tb.Cleanup(func() {
+		theDispatcher.detach(r)
+		if tb.Failed() {
+			r.Dump()
+		}
+	})
+	return r
+}
+
+// Context returns the context binding log statements to the
+// recorder. It can be passed to the tested code.
+func (r *Recorder) Context() context.Context {
+	return r.ctx
+}
+
+// Records returns the recorded records accepted by all
+// passed filters.
+func (r *Recorder) Records(filters ...logger.RecordFilter) []*logger.Record {
+	return r.ringLogger.Records(filters...)
+}
+
+// Reset drops all recorded records.
+func (r *Recorder) Reset() {
+	r.ringLogger.Reset()
+}
+
+// ExpectMessage checks if a message matching the pattern has been
+// logged with the given level.
+func (r *Recorder) ExpectMessage(level logger.LogLevel, pattern string) bool {
+	r.tb.Helper()
+	if len(r.matching(level, pattern)) == 0 {
+		r.tb.Errorf("expected %s message matching %q has not been logged", level, pattern)
+		return false
+	}
+	return true
+}
+
+// ExpectNoMessage checks if no message matching the pattern has been
+// logged with the given level.
+func (r *Recorder) ExpectNoMessage(level logger.LogLevel, pattern string) bool {
+	r.tb.Helper()
+	if rs := r.matching(level, pattern); len(rs) > 0 {
+		r.tb.Errorf("unexpected %s message matching %q has been logged: %q", level, pattern, rs[0].Message)
+		return false
+	}
+	return true
+}
+
+// ExpectNoErrors checks if no message with the error level or
+// above has been logged.
+func (r *Recorder) ExpectNoErrors() bool {
+	r.tb.Helper()
+	rs := r.Records(logger.LevelFilter(logger.LevelError))
+	if len(rs) > 0 {
+		r.tb.Errorf("expected no errors, but %d have been logged, first: %s %s", len(rs), rs[0].Info(), rs[0].Message)
+		return false
+	}
+	return true
+}
+
+// Dump writes all recorded records to the test log.
+func (r *Recorder) Dump() {
+	r.tb.Helper()
+	for _, rec := range r.Records() {
+		r.tb.Logf("%s [%s] %s %s", rec.Time.Format("15:04:05.000"), rec.Level, rec.Info(), rec.Message)
+	}
+}
+
+// matching returns the records with the level and a message
+// matching the pattern.
+func (r *Recorder) matching(level logger.LogLevel, pattern string) []*logger.Record {
+	r.tb.Helper()
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		r.tb.Fatalf("invalid pattern %q: %v", pattern, err)
+	}
+	return r.Records(func(rec *logger.Record) bool {
+		return rec.Level == level && re.MatchString(rec.Message)
+	})
+}
+
+// accept checks if a record passes the filters of the recorder.
+func (r *Recorder) accept(rec *logger.Record) bool {
+	for _, filter := range r.filters {
+		if !filter(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+//--------------------
+// DISPATCHER
+//--------------------
+
+// dispatcher is the logger backend as long as recorders are
+// attached. It passes the records bound to a recorder by their
+// context to this one, all others to all recorders. The backend
+// is switched with an own mutex, as logging holds the logger
+// lock while accessing the recorders.
+type dispatcher struct {
+	switchMutex sync.Mutex
+	mutex       sync.Mutex
+	recorders   map[*Recorder]struct{}
+	backend     logger.Logger
+}
+
+// theDispatcher is the one dispatcher for all recorders.
+var theDispatcher = &dispatcher{
+	recorders: make(map[*Recorder]struct{}),
+}
+
+// attach adds the recorder. In case of the first one the
+// dispatcher becomes the logger backend.
+func (d *dispatcher) attach(r *Recorder) {
+	d.switchMutex.Lock()
+	defer d.switchMutex.Unlock()
+	if d.len() == 0 {
+		d.backend = logger.SwapLogger(d)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.recorders[r] = struct{}{}
+}
+
+// detach removes the recorder. In case of the last one the
+// former logger backend is restored.
+func (d *dispatcher) detach(r *Recorder) {
+	d.switchMutex.Lock()
+	defer d.switchMutex.Unlock()
+	d.mutex.Lock()
+	delete(d.recorders, r)
+	d.mutex.Unlock()
+	if d.len() == 0 {
+		logger.SetLogger(d.backend)
+		d.backend = nil
+	}
+}
+
+// len returns the number of attached recorders.
+func (d *dispatcher) len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return len(d.recorders)
+}
+
+// Debug is specified on the Logger interface.
+func (d *dispatcher) Debug(info, msg string) {
+	d.do(func(r *Recorder) { r.ringLogger.Debug(info, msg) })
+}
+
+// Info is specified on the Logger interface.
+func (d *dispatcher) Info(info, msg string) {
+	d.do(func(r *Recorder) { r.ringLogger.Info(info, msg) })
+}
+
+// Warning is specified on the Logger interface.
+func (d *dispatcher) Warning(info, msg string) {
+	d.do(func(r *Recorder) { r.ringLogger.Warning(info, msg) })
+}
+
+// Error is specified on the Logger interface.
+func (d *dispatcher) Error(info, msg string) {
+	d.do(func(r *Recorder) { r.ringLogger.Error(info, msg) })
+}
+
+// Critical is specified on the Logger interface.
+func (d *dispatcher) Critical(info, msg string) {
+	d.do(func(r *Recorder) { r.ringLogger.Critical(info, msg) })
+}
+
+// Fatal is specified on the Logger interface.
+func (d *dispatcher) Fatal(info, msg string) {
+	d.do(func(r *Recorder) { r.ringLogger.Fatal(info, msg) })
+}
+
+// LogRecord is specified on the RecordLogger interface.
+func (d *dispatcher) LogRecord(rec *logger.Record) {
+	if r, ok := rec.Context().Value(recorderKey{}).(*Recorder); ok {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if _, attached := d.recorders[r]; attached && r.accept(rec) {
+			r.ringLogger.LogRecord(rec)
+		}
+		return
+	}
+	d.do(func(r *Recorder) {
+		if r.accept(rec) {
+			r.ringLogger.LogRecord(rec)
+		}
+	})
+}
+
+// do performs f for all attached recorders.
+func (d *dispatcher) do(f func(r *Recorder)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for r := range d.recorders {
+		f(r)
+	}
+}
+
+// EOF
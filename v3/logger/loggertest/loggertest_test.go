@@ -0,0 +1,166 @@
+// Tideland Go Application Support - Logger - Testing - Unit Tests
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package loggertest_test
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/tideland/goas/v3/logger"
+	"github.com/tideland/goas/v3/logger/loggertest"
+	"github.com/tideland/gots/v3/asserts"
+)
+
+//--------------------
+// TESTS
+//--------------------
+
+// Test the recording and the successful assertions.
+func TestRecorder(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	logger.SetLevel(logger.LevelDebug)
+	rec := loggertest.Start(t)
+
+	logger.Debugf("Debug %d.", 1)
+	logger.Warningf("Warning %d.", 2)
+
+	assert.Length(rec.Records(), 2)
+	assert.True(rec.ExpectMessage(logger.LevelDebug, `^Debug \d\.$`))
+	assert.True(rec.ExpectNoMessage(logger.LevelDebug, "Warning"))
+	assert.True(rec.ExpectNoErrors())
+
+	rec.Reset()
+	assert.Length(rec.Records(), 0)
+}
+
+// Test failing assertions and the dump.
+func TestRecorderFailures(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	tt := &testTB{TB: t}
+	logger.SetLevel(logger.LevelDebug)
+	rec := loggertest.Start(tt)
+
+	logger.Infof("Info.")
+	logger.Errorf("Error.")
+
+	assert.False(rec.ExpectMessage(logger.LevelInfo, "Error"))
+	assert.False(rec.ExpectNoMessage(logger.LevelError, "Err"))
+	assert.False(rec.ExpectNoErrors())
+	assert.Length(tt.errors, 3)
+	assert.Equal(tt.errors[0], `expected INFO message matching "Error" has not been logged`)
+
+	tt.cleanup()
+	assert.Length(tt.logs, 2)
+}
+
+// Test recorders of parallel tests.
+func TestParallelRecorders(t *testing.T) {
+	logger.SetLevel(logger.LevelDebug)
+	for i := 0; i < 5; i++ {
+		i := i
+		t.Run(fmt.Sprintf("recorder-%d", i), func(t *testing.T) {
+			t.Parallel()
+			assert := asserts.NewTestingAssertion(t, true)
+			rec := loggertest.Start(t, logger.PackageFilter("github.com/tideland/goas/v3/logger/loggertest_test"))
+			for j := 0; j < 100; j++ {
+				logger.LogContextf(rec.Context(), logger.LevelInfo, "recorder %d message %d", i, j)
+			}
+			assert.Length(rec.Records(), 100)
+			rec.ExpectMessage(logger.LevelInfo, fmt.Sprintf("recorder %d message 99", i))
+			rec.ExpectNoMessage(logger.LevelInfo, fmt.Sprintf("^recorder [^%d] ", i))
+			rec.ExpectNoErrors()
+		})
+	}
+}
+
+// Test that recorders only get the statements bound to them
+// or not bound at all.
+func TestBoundRecorders(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	logger.SetLevel(logger.LevelDebug)
+	outer := loggertest.Start(t)
+
+	t.Run("sibling", func(t *testing.T) {
+		inner := loggertest.Start(t)
+		logger.LogContextf(inner.Context(), logger.LevelInfo, "inner")
+		logger.LogContextf(outer.Context(), logger.LevelInfo, "outer")
+		slog.New(logger.NewSlogHandler()).InfoContext(inner.Context(), "slog inner")
+		logger.Infof("unbound")
+
+		inner.ExpectMessage(logger.LevelInfo, "^inner$")
+		inner.ExpectMessage(logger.LevelInfo, "^slog inner$")
+		inner.ExpectNoMessage(logger.LevelInfo, "^outer$")
+		assert.Length(inner.Records(), 3)
+	})
+	outer.ExpectMessage(logger.LevelInfo, "^outer$")
+	outer.ExpectMessage(logger.LevelInfo, "^unbound$")
+	outer.ExpectNoMessage(logger.LevelInfo, "inner")
+	assert.Length(outer.Records(), 2)
+}
+
+// Test the restoring of the former logger.
+func TestRestoring(t *testing.T) {
+	assert := asserts.NewTestingAssertion(t, true)
+	rl := logger.NewRingLogger(10)
+	logger.SetLevel(logger.LevelDebug)
+	logger.SetLogger(rl)
+
+	t.Run("recording", func(t *testing.T) {
+		rec := loggertest.Start(t)
+		logger.Infof("recorded")
+		rec.ExpectMessage(logger.LevelInfo, "recorded")
+	})
+	logger.Infof("not recorded")
+
+	rs := rl.Records()
+	assert.Length(rs, 1)
+	assert.Equal(rs[0].Message, "not recorded")
+}
+
+//--------------------
+// HELPERS
+//--------------------
+
+// testTB collects the errors and logs instead of failing.
+type testTB struct {
+	testing.TB
+	errors   []string
+	logs     []string
+	cleanups []func()
+}
+
+func (tt *testTB) Helper() {}
+
+func (tt *testTB) Errorf(format string, args ...interface{}) {
+	tt.errors = append(tt.errors, fmt.Sprintf(format, args...))
+}
+
+func (tt *testTB) Logf(format string, args ...interface{}) {
+	tt.logs = append(tt.logs, fmt.Sprintf(format, args...))
+}
+
+func (tt *testTB) Failed() bool {
+	return len(tt.errors) > 0
+}
+
+func (tt *testTB) Cleanup(f func()) {
+	tt.cleanups = append(tt.cleanups, f)
+}
+
+func (tt *testTB) cleanup() {
+	for _, f := range tt.cleanups {
+		f()
+	}
+}
+
+// EOF
@@ -0,0 +1,217 @@
+// Tideland Go Application Support - Logger - Ring Logger
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package logger
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//--------------------
+// FILTER
+//--------------------
+
+// RecordFilter decides if a record is part of a query result
+// or passed to a subscriber.
+type RecordFilter func(r *Record) bool
+
+// LevelFilter accepts all records with the given level or above.
+func LevelFilter(level LogLevel) RecordFilter {
+	return func(r *Record) bool {
+		return r.Level >= level
+	}
+}
+
+// PackageFilter accepts all records logged inside the given
+// package or one of its sub-packages.
+func PackageFilter(pkg string) RecordFilter {
+	return func(r *Record) bool {
+		rpkg := r.Package()
+		return rpkg == pkg || strings.HasPrefix(rpkg, pkg+"/")
+	}
+}
+
+// TimeFilter accepts all records logged between from and to. Zero
+// times leave the according side of the window open.
+func TimeFilter(from, to time.Time) RecordFilter {
+	return func(r *Record) bool {
+		if !from.IsZero() && r.Time.Before(from) {
+			return false
+		}
+		if !to.IsZero() && r.Time.After(to) {
+			return false
+		}
+		return true
+	}
+}
+
+// matches checks if a record is accepted by all filters.
+func matches(r *Record, filters []RecordFilter) bool {
+	for _, filter := range filters {
+		if !filter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+//--------------------
+// RING LOGGER
+//--------------------
+
+// RingLogger keeps the most recent records in memory. They can
+// be queried or streamed to subscribers, e.g. for an admin view
+// of a running application.
+type RingLogger struct {
+	mutex       sync.Mutex
+	records     []*Record
+	next        int
+	full        bool
+	subscribers map[chan<- *Record][]RecordFilter
+}
+
+// NewRingLogger creates a ring logger retaining the last
+// size records.
+func NewRingLogger(size int) *RingLogger {
+	if size < 1 {
+		size = 1
+	}
+	return &RingLogger{
+		records:     make([]*Record, size),
+		subscribers: make(map[chan<- *Record][]RecordFilter),
+	}
+}
+
+// Debug is specified on the Logger interface.
+func (rl *RingLogger) Debug(info, msg string) {
+	rl.LogRecord(newRecord(LevelDebug, parseCallInfo(info), msg))
+}
+
+// Info is specified on the Logger interface.
+func (rl *RingLogger) Info(info, msg string) {
+	rl.LogRecord(newRecord(LevelInfo, parseCallInfo(info), msg))
+}
+
+// Warning is specified on the Logger interface.
+func (rl *RingLogger) Warning(info, msg string) {
+	rl.LogRecord(newRecord(LevelWarning, parseCallInfo(info), msg))
+}
+
+// Error is specified on the Logger interface.
+func (rl *RingLogger) Error(info, msg string) {
+	rl.LogRecord(newRecord(LevelError, parseCallInfo(info), msg))
+}
+
+// Critical is specified on the Logger interface.
+func (rl *RingLogger) Critical(info, msg string) {
+	rl.LogRecord(newRecord(LevelCritical, parseCallInfo(info), msg))
+}
+
+// Fatal is specified on the Logger interface.
+func (rl *RingLogger) Fatal(info, msg string) {
+	rl.LogRecord(newRecord(LevelFatal, parseCallInfo(info), msg))
+}
+
+// LogRecord is specified on the RecordLogger interface. The record
+// is stored and passed to the matching subscribers. Subscribers not
+// ready to receive will miss the record instead of blocking the
+// logging.
+func (rl *RingLogger) LogRecord(r *Record) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.records[rl.next] = r
+	rl.next = (rl.next + 1) % len(rl.records)
+	if rl.next == 0 {
+		rl.full = true
+	}
+	for rc, filters := range rl.subscribers {
+		if matches(r, filters) {
+			clone := *r
+			select {
+			case rc <- &clone:
+			default:
+			}
+		}
+	}
+}
+
+// Records returns copies of the retained records accepted by all
+// passed filters, the oldest first.
+func (rl *RingLogger) Records(filters ...RecordFilter) []*Record {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rs := []*Record{}
+	rl.do(func(r *Record) {
+		if matches(r, filters) {
+			clone := *r
+			rs = append(rs, &clone)
+		}
+	})
+	return rs
+}
+
+// Snapshot returns copies of all retained records, the oldest first.
+func (rl *RingLogger) Snapshot() []*Record {
+	return rl.Records()
+}
+
+// Len returns the number of retained records.
+func (rl *RingLogger) Len() int {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if rl.full {
+		return len(rl.records)
+	}
+	return rl.next
+}
+
+// Reset drops all retained records.
+func (rl *RingLogger) Reset() {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.records = make([]*Record, len(rl.records))
+	rl.next = 0
+	rl.full = false
+}
+
+// Subscribe lets the ring logger send all new records accepted by
+// the passed filters to the channel. Sending does not block, so a
+// buffered channel is recommended.
+func (rl *RingLogger) Subscribe(rc chan<- *Record, filters ...RecordFilter) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.subscribers[rc] = filters
+}
+
+// Unsubscribe stops sending records to the channel.
+func (rl *RingLogger) Unsubscribe(rc chan<- *Record) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	delete(rl.subscribers, rc)
+}
+
+// do performs f for all retained records, the oldest first.
+func (rl *RingLogger) do(f func(r *Record)) {
+	if rl.full {
+		for _, r := range rl.records[rl.next:] {
+			f(r)
+		}
+	}
+	for _, r := range rl.records[:rl.next] {
+		f(r)
+	}
+}
+
+// EOF
@@ -0,0 +1,144 @@
+// Tideland Go Application Support - Logger - Shutdown
+//
+// Copyright (C) 2012-2014 Frank Mueller / Tideland / Oldenburg / Germany
+//
+// All rights reserved. Use of this source code is governed
+// by the new BSD license.
+
+package logger
+
+//--------------------
+// IMPORTS
+//--------------------
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//--------------------
+// SHUTDOWN CONTROL
+//--------------------
+
+// ShutdownHookFunc defines a function called during the shutdown
+// sequence after a Fatalf call, e.g. to stop loops or crontabs.
+type ShutdownHookFunc func() error
+
+// shutdownHook is a named shutdown hook.
+type shutdownHook struct {
+	name string
+	hook ShutdownHookFunc
+}
+
+// call calls the hook and also returns a panic as error.
+func (sh *shutdownHook) call() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return sh.hook()
+}
+
+// Flusher can be implemented by backends buffering the output.
+// It is flushed during the shutdown sequence after a Fatalf call.
+type Flusher interface {
+	// Flush writes all buffered log statements.
+	Flush() error
+}
+
+// Shutdown control variables. They have an own mutex, so that
+// the shutdown runs outside of the logging lock. The flag signals
+// a running shutdown sequence.
+var (
+	shutdownMux     sync.Mutex
+	shutdownHooks   []*shutdownHook
+	shutdownTimeout = 5 * time.Second
+	fatalExitCode   = -1
+	shutdownRunning int32
+)
+
+// AddShutdownHook adds a named hook to the shutdown sequence. The
+// hooks are called in the order they are added.
+func AddShutdownHook(name string, hook ShutdownHookFunc) {
+	shutdownMux.Lock()
+	defer shutdownMux.Unlock()
+	shutdownHooks = append(shutdownHooks, &shutdownHook{name, hook})
+}
+
+// ClearShutdownHooks removes all hooks from the shutdown sequence.
+func ClearShutdownHooks() {
+	shutdownMux.Lock()
+	defer shutdownMux.Unlock()
+	shutdownHooks = nil
+}
+
+// SetShutdownTimeout sets the maximum duration of the shutdown
+// hooks together and returns the current one.
+func SetShutdownTimeout(timeout time.Duration) time.Duration {
+	shutdownMux.Lock()
+	defer shutdownMux.Unlock()
+	current := shutdownTimeout
+	shutdownTimeout = timeout
+	return current
+}
+
+// FatalExitCode returns the exit code used by the OsFatalExiter.
+func FatalExitCode() int {
+	shutdownMux.Lock()
+	defer shutdownMux.Unlock()
+	return fatalExitCode
+}
+
+// SetFatalExitCode sets the exit code used by the OsFatalExiter
+// and returns the current one.
+func SetFatalExitCode(code int) int {
+	shutdownMux.Lock()
+	defer shutdownMux.Unlock()
+	current := fatalExitCode
+	fatalExitCode = code
+	return current
+}
+
+//--------------------
+// SHUTDOWN SEQUENCE
+//--------------------
+
+// shutdown runs the shutdown hooks, flushes the backend, and calls
+// the fatal exiter. Fatal log statements while the shutdown sequence
+// is running, e.g. in a hook or in other goroutines, do not start it
+// again and return.
+func shutdown(backend Logger, fef FatalExiterFunc) {
+	if !atomic.CompareAndSwapInt32(&shutdownRunning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&shutdownRunning, 0)
+
+	shutdownMux.Lock()
+	hooks := append([]*shutdownHook{}, shutdownHooks...)
+	timeout := shutdownTimeout
+	shutdownMux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, sh := range hooks {
+			if err := sh.call(); err != nil {
+				Criticalf("shutdown hook %q failed: %v", sh.name, err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		Criticalf("shutdown hooks timed out after %v", timeout)
+	}
+	if f, ok := backend.(Flusher); ok {
+		f.Flush()
+	}
+	fef()
+}
+
+// EOF